@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"prog2005assignment1/server/config"
+	"prog2005assignment1/server/fakeupstream"
+)
+
+/*
+Start a fake of the upstream APIs serving the fixtures, for local development without network access.
+Run from the repository root, then start the server with the printed environment variables.
+*/
+func main() {
+	addr := flag.String("addr", "localhost:8001", "address to listen on")
+	fixtures := flag.String("fixtures", fakeupstream.DefaultFixtures, "directory with fixture files")
+	pageSize := flag.Int("pagesize", fakeupstream.DefaultPageSize, "number of books per Gutendex page")
+	flag.Parse()
+
+	if *pageSize < 1 {
+		log.Fatal("Page size must be positive")
+	}
+
+	server, err := fakeupstream.New(*fixtures)
+	if err != nil {
+		log.Fatal("Could not load fixtures: " + err.Error())
+	}
+	server.PageSize = *pageSize
+
+	base := "http://" + *addr
+	log.Println("Serving fake upstream APIs from " + *fixtures + ". Point the server to them with:")
+	// The remote fallbacks point to the fake as well, so a failover never reaches the real APIs
+	log.Println("  " + config.EnvGutendexApi + "=" + base + fakeupstream.GutendexPath)
+	log.Println("  " + config.EnvGutendexApiRemote + "=" + base + fakeupstream.GutendexPath)
+	log.Println("  " + config.EnvLanguageApi + "=" + base + fakeupstream.LanguagePath)
+	log.Println("  " + config.EnvRestCountriesApi + "=" + base + fakeupstream.RestCountriesPath)
+	log.Println("  " + config.EnvRestCountriesApiRemote + "=" + base + fakeupstream.RestCountriesPath)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"container/list"
+	"prog2005assignment1/server/shared"
+	"sync"
+	"time"
+)
+
+// Estimated memory used by a book before counting its strings, and by a string before counting its bytes
+const bookOverhead = 192
+const stringOverhead = 16
+
+// Estimated memory used by a person, with its years, and by a format in the map of formats, before counting bytes
+const personOverhead = 32
+const formatOverhead = 48
+
+// Cache struct, an in-memory LRU cache of full Gutendex results, e.g. all books in a language.
+// Entries expire after the TTL, but are kept for another maxStale to be served while they are refreshed. The least
+// recently used entries are evicted when the estimated size exceeds the maximum. Safe for concurrent use.
+type Cache struct {
+	ttl      time.Duration
+	maxStale time.Duration
+	maxBytes int64
+	now      func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	order     *list.List // Most recently used at the front
+	bytes     int64
+	hits      int64
+	staleHits int64
+	misses    int64
+	evictions int64
+}
+
+/*
+A cached result, with its estimated size and the time it was stored.
+*/
+type entry struct {
+	key    string
+	value  shared.GutendexResult
+	size   int64
+	stored time.Time
+}
+
+// New
+/*
+Create a cache where entries live for ttl, and can be served stale for maxStale after that, using at most maxBytes of
+(estimated) memory.
+*/
+func New(ttl time.Duration, maxStale time.Duration, maxBytes int64) *Cache {
+	return &Cache{
+		ttl:      ttl,
+		maxStale: maxStale,
+		maxBytes: maxBytes,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Lookup
+/*
+Get the result stored under key and the time it was stored. Expired results are returned as well, as long as they
+expired less than maxStale ago, so they can be served while they are refreshed. Use Expired to tell them apart.
+Returns false if there is no such entry.
+*/
+func (c *Cache) Lookup(key string) (shared.GutendexResult, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return shared.GutendexResult{}, time.Time{}, false
+	}
+
+	e := element.Value.(*entry)
+	if c.now().Sub(e.stored) > c.ttl+c.maxStale {
+		c.remove(element)
+		c.misses++
+		return shared.GutendexResult{}, time.Time{}, false
+	}
+
+	c.order.MoveToFront(element)
+	if c.Expired(e.stored) {
+		c.staleHits++
+	} else {
+		c.hits++
+	}
+	return e.value, e.stored, true
+}
+
+// Set
+/*
+Store value under key, replacing any previous entry. Evicts the least recently used entries until the cache fits.
+A value larger than the whole cache is not stored.
+*/
+func (c *Cache) Set(key string, value shared.GutendexResult) {
+	c.SetAt(key, value, c.now())
+}
+
+// SetAt
+/*
+Store value under key like Set, but as if it was stored at the time stored, e.g. when it is loaded from disk.
+*/
+func (c *Cache) SetAt(key string, value shared.GutendexResult, stored time.Time) {
+	size := estimateSize(value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	if size > c.maxBytes {
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, size: size, stored: stored})
+	c.bytes += size
+
+	for c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// Expired
+/*
+Check if an entry stored at the time stored has expired.
+*/
+func (c *Cache) Expired(stored time.Time) bool {
+	return c.now().Sub(stored) > c.ttl
+}
+
+// Status
+/*
+Get the current size of the cache and its hit and miss counters.
+*/
+func (c *Cache) Status() shared.CacheStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return shared.CacheStatus{
+		Entries:   len(c.entries),
+		Bytes:     c.bytes,
+		MaxBytes:  c.maxBytes,
+		Hits:      c.hits,
+		StaleHits: c.staleHits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+/*
+Remove element from the cache. The caller must hold the lock.
+*/
+func (c *Cache) remove(element *list.Element) {
+	e := c.order.Remove(element).(*entry)
+	delete(c.entries, e.key)
+	c.bytes -= e.size
+}
+
+/*
+Estimate the memory used by a result, from the number of books and the length of their strings.
+*/
+func estimateSize(result shared.GutendexResult) int64 {
+	size := int64(len(result.Next) + len(result.Previous))
+
+	for _, book := range result.Results {
+		size += bookOverhead + stringOverhead + int64(len(book.Title))
+		for _, author := range book.Authors {
+			size += personOverhead + int64(len(author.Name))
+		}
+		for _, translator := range book.Translators {
+			size += personOverhead + int64(len(translator.Name))
+		}
+		for _, language := range book.Languages {
+			size += stringOverhead + int64(len(language))
+		}
+		for _, subject := range book.Subjects {
+			size += stringOverhead + int64(len(subject))
+		}
+		for _, bookshelf := range book.Bookshelves {
+			size += stringOverhead + int64(len(bookshelf))
+		}
+		size += stringOverhead + int64(len(book.MediaType))
+		for mimeType, url := range book.Formats {
+			size += formatOverhead + int64(len(mimeType)+len(url))
+		}
+	}
+
+	return size
+}
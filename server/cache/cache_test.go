@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"prog2005assignment1/server/shared"
+	"strconv"
+	"testing"
+	"time"
+)
+
+/*
+Create a result with n books, all with the same title length, so they have the same estimated size.
+*/
+func newResult(n int) shared.GutendexResult {
+	result := shared.GutendexResult{Count: n}
+	for i := 0; i < n; i++ {
+		result.Results = append(result.Results, shared.Book{Id: i, Title: "Book " + strconv.Itoa(i%10)})
+	}
+	return result
+}
+
+func TestCacheExpiry(t *testing.T) {
+	now := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+	stored := now
+	c := New(time.Hour, time.Hour, 1<<20)
+	c.now = func() time.Time { return now }
+
+	c.Set("no", newResult(21))
+
+	if result, at, ok := c.Lookup("no"); !ok || result.Count != 21 || !at.Equal(stored) || c.Expired(at) {
+		t.Fatalf("Expected fresh cached result, got: %v, %v, %v", result.Count, at, ok)
+	}
+
+	// Expired, but still within maxStale
+	now = now.Add(90 * time.Minute)
+	if result, at, ok := c.Lookup("no"); !ok || result.Count != 21 || !c.Expired(at) {
+		t.Fatalf("Expected stale cached result, got: %v, %v, %v", result.Count, at, ok)
+	}
+
+	now = now.Add(time.Hour)
+	if _, _, ok := c.Lookup("no"); ok {
+		t.Error("Expected entry to be removed after maxStale")
+	}
+
+	status := c.Status()
+	if status.Hits != 1 || status.StaleHits != 1 || status.Misses != 1 || status.Entries != 0 || status.Bytes != 0 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	size := estimateSize(newResult(10))
+	c := New(time.Hour, time.Hour, 2*size)
+
+	c.Set("no", newResult(10))
+	c.Set("sv", newResult(10))
+
+	// Use "no", so "sv" is the least recently used
+	if _, _, ok := c.Lookup("no"); !ok {
+		t.Fatal("Expected cached result for no")
+	}
+
+	c.Set("da", newResult(10))
+
+	if _, _, ok := c.Lookup("sv"); ok {
+		t.Error("Expected sv to be evicted")
+	}
+	if _, _, ok := c.Lookup("no"); !ok {
+		t.Error("Expected no to stay cached")
+	}
+	if _, _, ok := c.Lookup("da"); !ok {
+		t.Error("Expected da to be cached")
+	}
+
+	status := c.Status()
+	if status.Evictions != 1 || status.Entries != 2 || status.Bytes != 2*size {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestCacheTooLarge(t *testing.T) {
+	c := New(time.Hour, time.Hour, estimateSize(newResult(10)))
+
+	c.Set("en", newResult(11))
+
+	if _, _, ok := c.Lookup("en"); ok {
+		t.Error("Expected result larger than the cache not to be stored")
+	}
+}
+
+func TestCacheReplace(t *testing.T) {
+	c := New(time.Hour, time.Hour, 1<<20)
+
+	c.Set("no", newResult(10))
+	c.Set("no", newResult(20))
+
+	if result, _, _ := c.Lookup("no"); result.Count != 20 {
+		t.Errorf("Expected replaced result, got count: %v", result.Count)
+	}
+	if status := c.Status(); status.Entries != 1 || status.Bytes != estimateSize(newResult(20)) {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
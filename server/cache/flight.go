@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"prog2005assignment1/server/shared"
+	"sync"
+	"time"
+)
+
+// Group struct, used to coalesce identical fetches that are in flight at the same time, like singleflight.
+// Callers asking for a key that is already being fetched wait for that fetch instead of starting their own.
+type Group struct {
+	timeout time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+/*
+A fetch in flight, shared by all its waiters.
+*/
+type call struct {
+	done    chan struct{}
+	result  shared.GutendexResult
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// NewGroup
+/*
+Create an empty group, where every fetch is given at most timeout, 0 means no limit.
+*/
+func NewGroup(timeout time.Duration) *Group {
+	return &Group{timeout: timeout, calls: make(map[string]*call)}
+}
+
+// Do
+/*
+Run fetch for key, or wait for the fetch of key already in flight. fetch gets its own context, limited by the timeout
+of the group, so one client going away does not fail the others. A waiter whose ctx is done returns ctx.Err() right
+away. The fetch is only cancelled when every waiter has been cancelled, e.g. the clients went away. If the last
+waiter ran out of time instead, the fetch keeps running, so its result is still cached for the next request.
+*/
+func (g *Group) Do(ctx context.Context, key string,
+	fetch func(ctx context.Context) (shared.GutendexResult, error)) (shared.GutendexResult, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if !ok {
+		fetchCtx, cancel := context.WithCancel(context.Background())
+		if g.timeout > 0 {
+			fetchCtx, cancel = context.WithTimeout(context.Background(), g.timeout)
+		}
+		c = &call{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+
+		go func() {
+			c.result, c.err = fetch(fetchCtx)
+			cancel()
+
+			g.mu.Lock()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.result, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 && errors.Is(ctx.Err(), context.Canceled) {
+			// Nobody is waiting anymore, stop the fetch. New callers start a new one.
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+
+		return shared.GutendexResult{}, ctx.Err()
+	}
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"context"
+	"prog2005assignment1/server/shared"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupCoalesces(t *testing.T) {
+	g := NewGroup(0)
+	release := make(chan struct{})
+	var fetches int32
+
+	fetch := func(ctx context.Context) (shared.GutendexResult, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return shared.GutendexResult{Count: 21}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]shared.GutendexResult, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.Do(context.Background(), "no", fetch)
+		}(i)
+	}
+
+	// Let every caller join before the fetch finishes
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if fetches != 1 {
+		t.Errorf("Expected 1 fetch, got: %v", fetches)
+	}
+	for i, result := range results {
+		if result.Count != 21 {
+			t.Errorf("Caller %v got count %v, want 21", i, result.Count)
+		}
+	}
+}
+
+func TestGroupWaiterCancellation(t *testing.T) {
+	g := NewGroup(0)
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (shared.GutendexResult, error) {
+		select {
+		case <-release:
+			return shared.GutendexResult{Count: 21}, nil
+		case <-ctx.Done():
+			return shared.GutendexResult{}, ctx.Err()
+		}
+	}
+
+	// The first caller gives up, the second still gets the result
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := g.Do(ctx, "no", fetch)
+		firstErr <- err
+	}()
+
+	second := make(chan shared.GutendexResult)
+	go func() {
+		result, _ := g.Do(context.Background(), "no", fetch)
+		second <- result
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Errorf("Expected first caller to get context.Canceled, got: %v", err)
+	}
+
+	close(release)
+	if result := <-second; result.Count != 21 {
+		t.Errorf("Expected second caller to get the result, got count: %v", result.Count)
+	}
+}
+
+func TestGroupCancelledWhenAllWaitersLeave(t *testing.T) {
+	g := NewGroup(0)
+	fetchCancelled := make(chan struct{})
+	fetch := func(ctx context.Context) (shared.GutendexResult, error) {
+		<-ctx.Done()
+		close(fetchCancelled)
+		return shared.GutendexResult{}, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if _, err := g.Do(ctx, "no", fetch); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+
+	select {
+	case <-fetchCancelled:
+	case <-time.After(time.Second):
+		t.Error("Expected the fetch to be cancelled when its only waiter left")
+	}
+}
+
+func TestGroupOutlivesDeadline(t *testing.T) {
+	g := NewGroup(time.Second)
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (shared.GutendexResult, error) {
+		select {
+		case <-release:
+			return shared.GutendexResult{Count: 21}, nil
+		case <-ctx.Done():
+			return shared.GutendexResult{}, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.Do(ctx, "no", fetch); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	// The only waiter ran out of time, but the fetch keeps running, and the next caller joins it
+	close(release)
+	if result, err := g.Do(context.Background(), "no", fetch); err != nil || result.Count != 21 {
+		t.Errorf("Expected the fetch to finish, got: %v, %v", result.Count, err)
+	}
+}
+
+func TestGroupTimeout(t *testing.T) {
+	g := NewGroup(10 * time.Millisecond)
+	fetch := func(ctx context.Context) (shared.GutendexResult, error) {
+		<-ctx.Done()
+		return shared.GutendexResult{}, ctx.Err()
+	}
+
+	if _, err := g.Do(context.Background(), "no", fetch); err != context.DeadlineExceeded {
+		t.Errorf("Expected the fetch to time out, got: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Kinds of entries in the store, each kept in its own subdirectory
+const KindBooks = "books"
+const KindCountries = "countries"
+const KindPopulations = "populations"
+const KindTotal = "total"
+
+// File extension of the snapshots
+const snapshotExtension = ".json.gz"
+
+// Store struct, a directory of gzipped JSON snapshots that survives restarts. Every entry is a file
+// {dir}/{kind}/{key}.json.gz, holding the value and the time it was stored. Safe for concurrent use, since files are
+// written to a temporary file first and then renamed.
+type Store struct {
+	dir string
+}
+
+/*
+The content of a snapshot file.
+*/
+type snapshot struct {
+	Stored time.Time       `json:"stored"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// NewStore
+/*
+Create a store in dir, creating the directory if it does not exist.
+*/
+func NewStore(dir string) (*Store, error) {
+	for _, kind := range []string{KindBooks, KindCountries, KindPopulations, KindTotal} {
+		if err := os.MkdirAll(filepath.Join(dir, kind), 0o755); err != nil {
+			return nil, errors.New("could not create cache directory: " + err.Error())
+		}
+	}
+
+	return &Store{dir: dir}, nil
+}
+
+// Save
+/*
+Store value under kind and key, stamped with the time stored.
+*/
+func (s *Store) Save(kind string, key string, value interface{}, stored time.Time) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Join(s.dir, kind), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	writer := gzip.NewWriter(file)
+	err = json.NewEncoder(writer).Encode(snapshot{Stored: stored, Value: data})
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), s.path(kind, key))
+}
+
+// Load
+/*
+Call load with every entry of kind, in no particular order. Unreadable files are logged and skipped, so a corrupt
+snapshot does not keep the server from starting. Stops at the first error returned by load.
+*/
+func (s *Store) Load(kind string, load func(key string, value json.RawMessage, stored time.Time) error) error {
+	files, err := filepath.Glob(filepath.Join(s.dir, kind, "*"+snapshotExtension))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		key, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(file), snapshotExtension))
+		if err != nil {
+			log.Println("Skipping cache file with invalid name " + file)
+			continue
+		}
+
+		entry, err := readSnapshot(file)
+		if err != nil {
+			log.Println("Skipping unreadable cache file " + file + ": " + err.Error())
+			continue
+		}
+
+		if err = load(key, entry.Value, entry.Stored); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Get the path of the file for kind and key. The key is escaped, so it can be any string.
+*/
+func (s *Store) path(kind string, key string) string {
+	return filepath.Join(s.dir, kind, url.PathEscape(key)+snapshotExtension)
+}
+
+/*
+Read and decompress a snapshot file.
+*/
+func readSnapshot(path string) (snapshot, error) {
+	var entry snapshot
+
+	file, err := os.Open(path)
+	if err != nil {
+		return entry, err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return entry, err
+	}
+	defer reader.Close()
+
+	err = json.NewDecoder(reader).Decode(&entry)
+	return entry, err
+}
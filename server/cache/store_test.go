@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"prog2005assignment1/server/shared"
+	"testing"
+	"time"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+	if err = store.Save(KindBooks, "no", newResult(3), stored); err != nil {
+		t.Fatal(err)
+	}
+	// Keys are escaped, so any string can be used
+	if err = store.Save(KindBooks, "no/nb", newResult(1), stored); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := map[string]shared.GutendexResult{}
+	err = store.Load(KindBooks, func(key string, value json.RawMessage, loadedStored time.Time) error {
+		if !loadedStored.Equal(stored) {
+			t.Errorf("Expected stored time %v, got: %v", stored, loadedStored)
+		}
+
+		var result shared.GutendexResult
+		if err := json.Unmarshal(value, &result); err != nil {
+			return err
+		}
+		loaded[key] = result
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != 2 || loaded["no"].Count != 3 || loaded["no/nb"].Count != 1 {
+		t.Errorf("Unexpected loaded entries: %+v", loaded)
+	}
+}
+
+func TestStoreSkipsCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.Save(KindPopulations, "NOR", 5379475, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, KindPopulations, "ISL"+snapshotExtension), []byte("not gzip"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	err = store.Load(KindPopulations, func(key string, value json.RawMessage, stored time.Time) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 || keys[0] != "NOR" {
+		t.Errorf("Expected only NOR to be loaded, got: %v", keys)
+	}
+}
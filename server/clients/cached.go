@@ -0,0 +1,324 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"prog2005assignment1/server/cache"
+	"prog2005assignment1/server/shared"
+	"sync"
+	"time"
+)
+
+// CachedLanguages struct, a LanguageClient remembering the countries of each language for a TTL.
+// If a store is set, the countries are also saved to disk, and restored after a restart by Load.
+type CachedLanguages struct {
+	LanguageClient
+	ttl   time.Duration
+	store *cache.Store
+	now   func() time.Time
+
+	mu        sync.Mutex
+	countries map[string]cachedCountries
+}
+
+// CachedCountries struct, a CountriesClient remembering the population of each country for a TTL.
+// If a store is set, the populations are also saved to disk, and restored after a restart by Load.
+type CachedCountries struct {
+	CountriesClient
+	ttl   time.Duration
+	store *cache.Store
+	now   func() time.Time
+
+	mu          sync.Mutex
+	populations map[string]cachedPopulation
+}
+
+/*
+Countries of a language, and when they were fetched.
+*/
+type cachedCountries struct {
+	countries []shared.Country
+	stored    time.Time
+}
+
+/*
+Population of a country, and when it was fetched.
+*/
+type cachedPopulation struct {
+	population int
+	stored     time.Time
+}
+
+// NewCachedLanguages
+/*
+Wrap languages in a cache where entries live for ttl. store may be nil, then nothing is saved to disk.
+*/
+func NewCachedLanguages(languages LanguageClient, ttl time.Duration, store *cache.Store) *CachedLanguages {
+	return &CachedLanguages{
+		LanguageClient: languages,
+		ttl:            ttl,
+		store:          store,
+		now:            time.Now,
+		countries:      make(map[string]cachedCountries),
+	}
+}
+
+// NewCachedCountries
+/*
+Wrap countries in a cache where entries live for ttl. store may be nil, then nothing is saved to disk.
+*/
+func NewCachedCountries(countries CountriesClient, ttl time.Duration, store *cache.Store) *CachedCountries {
+	return &CachedCountries{
+		CountriesClient: countries,
+		ttl:             ttl,
+		store:           store,
+		now:             time.Now,
+		populations:     make(map[string]cachedPopulation),
+	}
+}
+
+// Known
+/*
+A language with cached countries is known, even if the entry has expired. Other languages are checked upstream.
+*/
+func (c *CachedLanguages) Known(ctx context.Context, language string) (bool, error) {
+	c.mu.Lock()
+	_, ok := c.countries[language]
+	c.mu.Unlock()
+
+	if ok {
+		return true, nil
+	}
+	return c.LanguageClient.Known(ctx, language)
+}
+
+// Countries
+/*
+Get the countries of language from the cache, or upstream if they are missing or expired. If the upstream fails, an
+expired entry is better than nothing and is returned instead of the error.
+*/
+func (c *CachedLanguages) Countries(ctx context.Context, language string) ([]shared.Country, error) {
+	c.mu.Lock()
+	entry, ok := c.countries[language]
+	c.mu.Unlock()
+
+	if ok && c.now().Sub(entry.stored) <= c.ttl {
+		return entry.countries, nil
+	}
+
+	countries, err := c.LanguageClient.Countries(ctx, language)
+	if err != nil {
+		if ok {
+			log.Println("Using expired countries of " + language + ": " + err.Error())
+			return entry.countries, nil
+		}
+		return nil, err
+	}
+
+	// An empty result is not cached, the language is unknown or the upstream had a hiccup
+	if len(countries) > 0 {
+		c.set(language, countries, c.now())
+		c.save(language, countries)
+	}
+
+	return countries, nil
+}
+
+// Load
+/*
+Restore the countries saved in the store. Returns the languages whose entries have expired, to be refreshed.
+*/
+func (c *CachedLanguages) Load() ([]string, error) {
+	if c.store == nil {
+		return nil, nil
+	}
+
+	var stale []string
+	err := c.store.Load(cache.KindCountries, func(key string, value json.RawMessage, stored time.Time) error {
+		var countries []shared.Country
+		if err := json.Unmarshal(value, &countries); err != nil {
+			return err
+		}
+
+		c.set(key, countries, stored)
+		if c.now().Sub(stored) > c.ttl {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+
+	return stale, err
+}
+
+// Refresh
+/*
+Fetch the countries of the languages again, replacing the cached entries.
+*/
+func (c *CachedLanguages) Refresh(ctx context.Context, languages []string) {
+	for _, language := range languages {
+		countries, err := c.LanguageClient.Countries(ctx, language)
+		if err != nil {
+			log.Println("Could not refresh countries of " + language + ": " + err.Error())
+			continue
+		}
+		if len(countries) > 0 {
+			c.set(language, countries, c.now())
+			c.save(language, countries)
+		}
+	}
+}
+
+/*
+Store countries in memory.
+*/
+func (c *CachedLanguages) set(language string, countries []shared.Country, stored time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.countries[language] = cachedCountries{countries: countries, stored: stored}
+}
+
+/*
+Save countries to disk, if there is a store.
+*/
+func (c *CachedLanguages) save(language string, countries []shared.Country) {
+	if c.store == nil {
+		return
+	}
+	if err := c.store.Save(cache.KindCountries, language, countries, c.now()); err != nil {
+		log.Println("Could not save countries of " + language + " to disk: " + err.Error())
+	}
+}
+
+// Population
+/*
+Get the population of a country from the cache, or upstream if it is missing or expired.
+*/
+func (c *CachedCountries) Population(ctx context.Context, alpha3 string) (int, error) {
+	if population, ok := c.fresh(alpha3); ok {
+		return population, nil
+	}
+
+	population, err := c.CountriesClient.Population(ctx, alpha3)
+	if err != nil {
+		return 0, err
+	}
+
+	c.set(map[string]int{alpha3: population})
+	return population, nil
+}
+
+// Populations
+/*
+Get the populations of the countries, looking up only the ones missing from the cache, or expired, upstream.
+*/
+func (c *CachedCountries) Populations(ctx context.Context, alpha3 []string) (map[string]int, error) {
+	populations := make(map[string]int, len(alpha3))
+	var missing []string
+	for _, code := range alpha3 {
+		if population, ok := c.fresh(code); ok {
+			populations[code] = population
+		} else {
+			missing = append(missing, code)
+		}
+	}
+
+	if len(missing) == 0 {
+		return populations, nil
+	}
+
+	fetched, err := c.CountriesClient.Populations(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	c.set(fetched)
+	for code, population := range fetched {
+		populations[code] = population
+	}
+	return populations, nil
+}
+
+// Load
+/*
+Restore the populations saved in the store. Returns the countries whose entries have expired, to be refreshed.
+*/
+func (c *CachedCountries) Load() ([]string, error) {
+	if c.store == nil {
+		return nil, nil
+	}
+
+	var stale []string
+	err := c.store.Load(cache.KindPopulations, func(key string, value json.RawMessage, stored time.Time) error {
+		var population int
+		if err := json.Unmarshal(value, &population); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.populations[key] = cachedPopulation{population: population, stored: stored}
+		c.mu.Unlock()
+
+		if c.now().Sub(stored) > c.ttl {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+
+	return stale, err
+}
+
+// Refresh
+/*
+Fetch the populations of the countries again in a batch, replacing the cached entries.
+*/
+func (c *CachedCountries) Refresh(ctx context.Context, alpha3 []string) {
+	if len(alpha3) == 0 {
+		return
+	}
+
+	populations, err := c.CountriesClient.Populations(ctx, alpha3)
+	if err != nil {
+		log.Println("Could not refresh populations: " + err.Error())
+		return
+	}
+
+	c.set(populations)
+}
+
+/*
+Get the population of a country if it is cached and has not expired.
+*/
+func (c *CachedCountries) fresh(alpha3 string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.populations[alpha3]
+	if !ok || c.now().Sub(entry.stored) > c.ttl {
+		return 0, false
+	}
+	return entry.population, true
+}
+
+/*
+Store populations in memory, and on disk if there is a store.
+*/
+func (c *CachedCountries) set(populations map[string]int) {
+	now := c.now()
+
+	c.mu.Lock()
+	for code, population := range populations {
+		c.populations[code] = cachedPopulation{population: population, stored: now}
+	}
+	c.mu.Unlock()
+
+	if c.store == nil {
+		return
+	}
+	for code, population := range populations {
+		if err := c.store.Save(cache.KindPopulations, code, population, now); err != nil {
+			log.Println("Could not save population of " + code + " to disk: " + err.Error())
+		}
+	}
+}
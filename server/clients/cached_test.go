@@ -0,0 +1,105 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"prog2005assignment1/server/cache"
+	"prog2005assignment1/server/shared"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCachedCountriesPopulations(t *testing.T) {
+	fake := &FakeCountries{Known: map[string]int{"NOR": 5379475, "ISL": 366425, "SJM": 2562}}
+	countries := NewCachedCountries(fake, time.Hour, nil)
+
+	if _, err := countries.Population(context.Background(), "NOR"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the countries missing from the cache are looked up
+	populations, err := countries.Populations(context.Background(), []string{"NOR", "ISL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if populations["NOR"] != 5379475 || populations["ISL"] != 366425 {
+		t.Errorf("Unexpected populations: %v", populations)
+	}
+
+	if _, err = countries.Populations(context.Background(), []string{"NOR", "ISL"}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.SingleCalls != 1 || fake.BatchCalls != 1 {
+		t.Errorf("Expected 1 single and 1 batch lookup, got: %v and %v", fake.SingleCalls, fake.BatchCalls)
+	}
+}
+
+func TestCachedLanguagesExpiredFallback(t *testing.T) {
+	norway := []shared.Country{{Iso31661Alpha3: "NOR", OfficialName: "Norway"}}
+	fake := &FakeLanguages{Languages: map[string][]shared.Country{"no": norway}}
+	languages := NewCachedLanguages(fake, time.Hour, nil)
+
+	now := time.Now()
+	languages.now = func() time.Time { return now }
+
+	if _, err := languages.Countries(context.Background(), "no"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The entry expires and the upstream goes down, the expired entry is used
+	now = now.Add(2 * time.Hour)
+	fake.Err = errors.New("connection refused")
+
+	countries, err := languages.Countries(context.Background(), "no")
+	if err != nil || !reflect.DeepEqual(countries, norway) {
+		t.Errorf("Expected expired countries, got: %v, %v", countries, err)
+	}
+
+	// Cached languages are known without asking the upstream
+	if known, err := languages.Known(context.Background(), "no"); !known || err != nil {
+		t.Errorf("Expected no to be known, got: %v, %v", known, err)
+	}
+}
+
+func TestCachedLoadFromStore(t *testing.T) {
+	store, err := cache.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One fresh and one expired population on disk
+	if err = store.Save(cache.KindPopulations, "NOR", 5379475, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Save(cache.KindPopulations, "ISL", 300000, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &FakeCountries{Known: map[string]int{"ISL": 366425}}
+	countries := NewCachedCountries(fake, time.Hour, store)
+
+	stale, err := countries.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stale, []string{"ISL"}) {
+		t.Fatalf("Expected ISL to be stale, got: %v", stale)
+	}
+
+	// The fresh entry is served without the upstream, which does not know NOR
+	if population, err := countries.Population(context.Background(), "NOR"); err != nil || population != 5379475 {
+		t.Errorf("Expected population from disk, got: %v, %v", population, err)
+	}
+
+	countries.Refresh(context.Background(), stale)
+	if population, err := countries.Population(context.Background(), "ISL"); err != nil || population != 366425 {
+		t.Errorf("Expected refreshed population, got: %v, %v", population, err)
+	}
+
+	// A new client on the same directory sees the refreshed population
+	restarted := NewCachedCountries(&FakeCountries{}, time.Hour, store)
+	if stale, err = restarted.Load(); err != nil || len(stale) != 0 {
+		t.Errorf("Expected nothing stale after refresh, got: %v, %v", stale, err)
+	}
+}
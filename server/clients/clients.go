@@ -0,0 +1,41 @@
+package clients
+
+import (
+	"context"
+	"prog2005assignment1/server/shared"
+)
+
+// GutendexClient interface, used by the handlers to fetch books from the Gutendex API
+type GutendexClient interface {
+	// Page returns a page of books in the given two-letter language, the first page is 1
+	Page(ctx context.Context, language string, page int) (shared.GutendexResult, error)
+	// Total returns the number of books in the whole library
+	Total(ctx context.Context) (int, error)
+	// StatusCode returns the HTTP status code of the service, 503 if it is not reachable
+	StatusCode(ctx context.Context) int
+	// Upstream returns which upstream is in use
+	Upstream() shared.UpstreamStatus
+}
+
+// LanguageClient interface, used by the handlers to look up languages in the Language2Countries API
+type LanguageClient interface {
+	// Known reports whether the two-letter language code is known by the service
+	Known(ctx context.Context, language string) (bool, error)
+	// Countries returns the countries where the language is spoken, empty if there are none
+	Countries(ctx context.Context, language string) ([]shared.Country, error)
+	// StatusCode returns the HTTP status code of the service, 503 if it is not reachable
+	StatusCode(ctx context.Context) int
+}
+
+// CountriesClient interface, used by the handlers to look up countries in the RestCountries API
+type CountriesClient interface {
+	// Population returns the population of the country with the given ISO 3166-1 alpha-3 code
+	Population(ctx context.Context, alpha3 string) (int, error)
+	// Populations returns the populations of many countries by alpha-3 code, using as few requests as possible.
+	// Countries that are not found are left out of the map.
+	Populations(ctx context.Context, alpha3 []string) (map[string]int, error)
+	// StatusCode returns the HTTP status code of the service, 503 if it is not reachable
+	StatusCode(ctx context.Context) int
+	// Upstream returns which upstream is in use
+	Upstream() shared.UpstreamStatus
+}
@@ -0,0 +1,223 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"prog2005assignment1/server/shared"
+	"strconv"
+	"sync/atomic"
+)
+
+// Default page size of the fake Gutendex, the same as the real one
+const fakePageSize = 32
+
+// FakeGutendex struct, an in-memory GutendexClient used in tests. Books are paginated like the real API.
+// If set, PageHook is called before a page is served, and its error is returned instead of the page.
+type FakeGutendex struct {
+	Library  []shared.Book
+	PageSize int
+	Err      error
+	Status   int
+	PageHook func(ctx context.Context, language string, page int) error
+}
+
+// FakeLanguages struct, an in-memory LanguageClient used in tests. Maps two-letter language codes to countries.
+type FakeLanguages struct {
+	Languages map[string][]shared.Country
+	Err       error
+	Status    int
+}
+
+// FakeCountries struct, an in-memory CountriesClient used in tests. Maps ISO 3166-1 alpha-3 codes to populations.
+// BatchErr only fails batch lookups, and the lookups are counted in BatchCalls and SingleCalls.
+type FakeCountries struct {
+	Known       map[string]int
+	Err         error
+	BatchErr    error
+	Status      int
+	BatchCalls  int32
+	SingleCalls int32
+}
+
+// Page
+/*
+Return page number page of the books in language.
+*/
+func (f *FakeGutendex) Page(ctx context.Context, language string, page int) (shared.GutendexResult, error) {
+	if f.PageHook != nil {
+		if err := f.PageHook(ctx, language, page); err != nil {
+			return shared.GutendexResult{}, err
+		}
+	}
+	return f.page(language, page)
+}
+
+// Total
+/*
+Return the number of books in the library.
+*/
+func (f *FakeGutendex) Total(ctx context.Context) (int, error) {
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	return len(f.Library), nil
+}
+
+// StatusCode
+/*
+Return Status, 200 if not set.
+*/
+func (f *FakeGutendex) StatusCode(ctx context.Context) int {
+	return fakeStatus(f.Status)
+}
+
+// Upstream
+/*
+Return a fixed upstream status.
+*/
+func (f *FakeGutendex) Upstream() shared.UpstreamStatus {
+	return shared.UpstreamStatus{Active: "fake://gutendex/"}
+}
+
+/*
+Return page number page of the books in language, with a "next" URL if there are more pages.
+*/
+func (f *FakeGutendex) page(language string, page int) (shared.GutendexResult, error) {
+	if f.Err != nil {
+		return shared.GutendexResult{}, f.Err
+	}
+
+	var books []shared.Book
+	for _, book := range f.Library {
+		for _, bookLanguage := range book.Languages {
+			if bookLanguage == language {
+				books = append(books, book)
+				break
+			}
+		}
+	}
+
+	pageSize := f.PageSize
+	if pageSize <= 0 {
+		pageSize = fakePageSize
+	}
+
+	result := shared.GutendexResult{Count: len(books), Results: []shared.Book{}}
+	start := (page - 1) * pageSize
+	if start < 0 || (start >= len(books) && page != 1) {
+		return shared.GutendexResult{}, errors.New("invalid page " + strconv.Itoa(page))
+	}
+
+	end := start + pageSize
+	if end >= len(books) {
+		end = len(books)
+	} else {
+		result.Next = "fake://gutendex/?languages=" + language + "&page=" + strconv.Itoa(page+1)
+	}
+	if page > 1 {
+		result.Previous = "fake://gutendex/?languages=" + language + "&page=" + strconv.Itoa(page-1)
+	}
+
+	result.Results = append(result.Results, books[start:end]...)
+	return result, nil
+}
+
+// Known
+/*
+Report whether the language is in Languages.
+*/
+func (f *FakeLanguages) Known(ctx context.Context, language string) (bool, error) {
+	if f.Err != nil {
+		return false, f.Err
+	}
+	_, ok := f.Languages[language]
+	return ok, nil
+}
+
+// Countries
+/*
+Return the countries of the language, empty if unknown.
+*/
+func (f *FakeLanguages) Countries(ctx context.Context, language string) ([]shared.Country, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	countries, ok := f.Languages[language]
+	if !ok {
+		return []shared.Country{}, nil
+	}
+	return countries, nil
+}
+
+// StatusCode
+/*
+Return Status, 200 if not set.
+*/
+func (f *FakeLanguages) StatusCode(ctx context.Context) int {
+	return fakeStatus(f.Status)
+}
+
+// Population
+/*
+Return the population of the country, or an error if it is unknown.
+*/
+func (f *FakeCountries) Population(ctx context.Context, alpha3 string) (int, error) {
+	atomic.AddInt32(&f.SingleCalls, 1)
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	population, ok := f.Known[alpha3]
+	if !ok {
+		return 0, errors.New("no country with code " + alpha3)
+	}
+	return population, nil
+}
+
+// Populations
+/*
+Return the populations of the known countries among alpha3.
+*/
+func (f *FakeCountries) Populations(ctx context.Context, alpha3 []string) (map[string]int, error) {
+	atomic.AddInt32(&f.BatchCalls, 1)
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if f.BatchErr != nil {
+		return nil, f.BatchErr
+	}
+
+	populations := make(map[string]int)
+	for _, code := range alpha3 {
+		if population, ok := f.Known[code]; ok {
+			populations[code] = population
+		}
+	}
+	return populations, nil
+}
+
+// StatusCode
+/*
+Return Status, 200 if not set.
+*/
+func (f *FakeCountries) StatusCode(ctx context.Context) int {
+	return fakeStatus(f.Status)
+}
+
+// Upstream
+/*
+Return a fixed upstream status.
+*/
+func (f *FakeCountries) Upstream() shared.UpstreamStatus {
+	return shared.UpstreamStatus{Active: "fake://restcountries/"}
+}
+
+/*
+Return status, or 200 if status is not set.
+*/
+func fakeStatus(status int) int {
+	if status == 0 {
+		return http.StatusOK
+	}
+	return status
+}
@@ -0,0 +1,293 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/upstream"
+	"strconv"
+	"strings"
+)
+
+// Longest URL sent to RestCountries, most servers and proxies accept at least 2000 characters
+const maxURLLength = 2000
+
+// HTTPGutendex struct, the GutendexClient talking to the Gutendex API over HTTP
+type HTTPGutendex struct {
+	client *http.Client
+	pool   *upstream.Pool
+}
+
+// HTTPLanguages struct, the LanguageClient talking to the Language2Countries API over HTTP
+type HTTPLanguages struct {
+	client      *http.Client
+	checkClient *http.Client
+	base        string
+}
+
+// HTTPCountries struct, the CountriesClient talking to the RestCountries API over HTTP
+type HTTPCountries struct {
+	client *http.Client
+	pool   *upstream.Pool
+}
+
+// NewHTTPGutendex
+/*
+Create a Gutendex client sending requests through pool.
+*/
+func NewHTTPGutendex(client *http.Client, pool *upstream.Pool) *HTTPGutendex {
+	return &HTTPGutendex{client: client, pool: pool}
+}
+
+// NewHTTPLanguages
+/*
+Create a Language2Countries client for the API at base. checkClient is used for Known, which is called for every
+requested language and therefore usually has a shorter timeout.
+*/
+func NewHTTPLanguages(client *http.Client, checkClient *http.Client, base string) *HTTPLanguages {
+	return &HTTPLanguages{client: client, checkClient: checkClient, base: strings.TrimSuffix(base, "/")}
+}
+
+// NewHTTPCountries
+/*
+Create a RestCountries client sending requests through pool.
+*/
+func NewHTTPCountries(client *http.Client, pool *upstream.Pool) *HTTPCountries {
+	return &HTTPCountries{client: client, pool: pool}
+}
+
+// Page
+/*
+Get page number page of the books in language. Pages are requested by number from the active upstream, so the
+"next" URLs in the responses, which point to the upstream serving the previous page, are never followed.
+*/
+func (g *HTTPGutendex) Page(ctx context.Context, language string, page int) (shared.GutendexResult, error) {
+	var result shared.GutendexResult
+	res, err := g.pool.Get(ctx, g.client, "?languages="+language+"&page="+strconv.Itoa(page))
+	if err != nil {
+		return result, err
+	}
+
+	err = decode(res, &result)
+	return result, err
+}
+
+// Total
+/*
+Get the number of books in the whole library.
+*/
+func (g *HTTPGutendex) Total(ctx context.Context) (int, error) {
+	var result shared.GutendexResult
+	res, err := g.pool.Get(ctx, g.client, "")
+	if err != nil {
+		return 0, err
+	}
+
+	err = decode(res, &result)
+	return result.Count, err
+}
+
+// StatusCode
+/*
+Get the status code of the active Gutendex upstream.
+*/
+func (g *HTTPGutendex) StatusCode(ctx context.Context) int {
+	return statusCode(ctx, g.client, g.pool.Active())
+}
+
+// Upstream
+/*
+Get the state of the Gutendex upstream pool.
+*/
+func (g *HTTPGutendex) Upstream() shared.UpstreamStatus {
+	return g.pool.Status()
+}
+
+// Known
+/*
+Check if the language is known by the Language2Countries API. The API answers 204 for unknown languages.
+*/
+func (l *HTTPLanguages) Known(ctx context.Context, language string) (bool, error) {
+	res, err := get(ctx, l.checkClient, l.base+"/"+language)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusOK:
+		return true, nil
+	case res.StatusCode >= http.StatusInternalServerError:
+		return false, errors.New("language API answered " + res.Status)
+	default:
+		// 204, or any other status: service is available, but the language code is not valid
+		return false, nil
+	}
+}
+
+// Countries
+/*
+Get all countries that use the language.
+*/
+func (l *HTTPLanguages) Countries(ctx context.Context, language string) ([]shared.Country, error) {
+	res, err := get(ctx, l.client, l.base+"/"+language)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNoContent {
+		res.Body.Close()
+		return []shared.Country{}, nil
+	}
+
+	var countries []shared.Country
+	err = decode(res, &countries)
+	return countries, err
+}
+
+// StatusCode
+/*
+Get the status code of the Language2Countries API. A language has to be added, the API answers 204 otherwise.
+*/
+func (l *HTTPLanguages) StatusCode(ctx context.Context) int {
+	return statusCode(ctx, l.client, l.base+"/en")
+}
+
+// Population
+/*
+Get the population of the country with ISO 3166-1 alpha-3 code alpha3.
+*/
+func (c *HTTPCountries) Population(ctx context.Context, alpha3 string) (int, error) {
+	res, err := c.pool.Get(ctx, c.client, "/alpha/"+alpha3)
+	if err != nil {
+		return 0, err
+	}
+
+	// Could return multiple countries, but since we use alpha3 code, in reality we only get one
+	var countries []shared.CountryFromRestCountries
+	if err = decode(res, &countries); err != nil {
+		return 0, err
+	}
+	if len(countries) == 0 {
+		return 0, errors.New("no country with code " + alpha3)
+	}
+
+	return countries[0].Population, nil
+}
+
+// Populations
+/*
+Get the populations of the countries with the given alpha-3 codes from the /alpha?codes= endpoint. The codes are split
+into as few requests as the URL length limit allows. Fails if any of the requests fails.
+*/
+func (c *HTTPCountries) Populations(ctx context.Context, alpha3 []string) (map[string]int, error) {
+	populations := make(map[string]int, len(alpha3))
+
+	for _, chunk := range chunkCodes(alpha3, maxURLLength-len(c.pool.Active())-len("/alpha?codes=")) {
+		res, err := c.pool.Get(ctx, c.client, "/alpha?codes="+strings.Join(chunk, ","))
+		if err != nil {
+			return nil, err
+		}
+
+		var countries []shared.CountryFromRestCountries
+		if err = decode(res, &countries); err != nil {
+			return nil, err
+		}
+
+		for _, country := range countries {
+			populations[country.Cca3] = country.Population
+		}
+	}
+
+	return populations, nil
+}
+
+// StatusCode
+/*
+Get the status code of the active RestCountries upstream. /all has to be added, the API answers 404 otherwise.
+*/
+func (c *HTTPCountries) StatusCode(ctx context.Context) int {
+	return statusCode(ctx, c.client, strings.TrimSuffix(c.pool.Active(), "/")+"/all")
+}
+
+// Upstream
+/*
+Get the state of the RestCountries upstream pool.
+*/
+func (c *HTTPCountries) Upstream() shared.UpstreamStatus {
+	return c.pool.Status()
+}
+
+/*
+Split codes into chunks, where each chunk joined by commas is at most maxLength long.
+*/
+func chunkCodes(codes []string, maxLength int) [][]string {
+	var chunks [][]string
+	var chunk []string
+	length := 0
+
+	for _, code := range codes {
+		// The comma separating the code from the previous one
+		added := len(code)
+		if len(chunk) > 0 {
+			added++
+		}
+
+		if len(chunk) > 0 && length+added > maxLength {
+			chunks = append(chunks, chunk)
+			chunk, length, added = nil, 0, len(code)
+		}
+
+		chunk = append(chunk, code)
+		length += added
+	}
+
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+/*
+Make a GET request bound to ctx.
+*/
+func get(ctx context.Context, client *http.Client, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req)
+}
+
+/*
+Decode the JSON body of res into target and close the body. Any status other than 200 is an error.
+*/
+func decode(res *http.Response, target interface{}) error {
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.New("unexpected status " + strconv.Itoa(res.StatusCode) + " from " + res.Request.URL.String())
+	}
+
+	return json.NewDecoder(res.Body).Decode(target)
+}
+
+/*
+Get the status code of rawURL. Returns 503 if the service is not reachable.
+*/
+func statusCode(ctx context.Context, client *http.Client, rawURL string) int {
+	res, err := get(ctx, client, rawURL)
+	if err != nil {
+		return http.StatusServiceUnavailable
+	}
+
+	err = res.Body.Close()
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+
+	return res.StatusCode
+}
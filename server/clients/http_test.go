@@ -0,0 +1,178 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"prog2005assignment1/server/upstream"
+	"reflect"
+	"testing"
+)
+
+/*
+Create a test server using handler, closed when the test ends.
+*/
+func newTestServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPGutendex(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("languages") != "no" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.URL.Query().Get("page") {
+		case "1":
+			// Next points to another host, like a page served by the mirror, and is not followed
+			w.Write([]byte(`{"count": 2, "next": "https://gutendex.com/books/?languages=no&page=2",
+				"results": [{"id": 1, "title": "Sult", "languages": ["no"]}]}`))
+		case "2":
+			w.Write([]byte(`{"count": 2, "next": null, "results": [{"id": 2, "title": "Pan", "languages": ["no"]}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	pool := upstream.NewPool("gutendex", server.URL+"/books/", server.URL+"/mirror/", "")
+	gutendex := NewHTTPGutendex(server.Client(), pool)
+
+	first, err := gutendex.Page(context.Background(), "no", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Count != 2 || len(first.Results) != 1 || first.Next == "" {
+		t.Fatalf("Unexpected first page: %+v", first)
+	}
+
+	second, err := gutendex.Page(context.Background(), "no", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Results) != 1 || second.Results[0].Title != "Pan" || second.Next != "" {
+		t.Errorf("Unexpected second page: %+v", second)
+	}
+
+	if _, err = gutendex.Page(context.Background(), "no", 3); err == nil {
+		t.Error("Expected error for page out of range")
+	}
+
+	if status := gutendex.StatusCode(context.Background()); status != http.StatusNotFound {
+		t.Errorf("Unexpected status code: %v", status)
+	}
+}
+
+func TestHTTPLanguages(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/language2countries/no":
+			w.Write([]byte(`[{"ISO3166_1_Alpha_3": "NOR", "ISO3166_1_Alpha_2": "NO", "Official_Name": "Norway"}]`))
+		case "/language2countries/zz":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	languages := NewHTTPLanguages(server.Client(), server.Client(), server.URL+"/language2countries/")
+
+	tests := []struct {
+		name      string
+		language  string
+		wantKnown bool
+		wantErr   bool
+	}{
+		{"Known language", "no", true, false},
+		{"Unknown language", "xx", false, false},
+		{"Server error", "zz", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			known, err := languages.Known(context.Background(), tt.language)
+			if known != tt.wantKnown || (err != nil) != tt.wantErr {
+				t.Errorf("Known() = %v, %v, want %v, error %v", known, err, tt.wantKnown, tt.wantErr)
+			}
+		})
+	}
+
+	countries, err := languages.Countries(context.Background(), "no")
+	if err != nil || len(countries) != 1 || countries[0].OfficialName != "Norway" {
+		t.Errorf("Unexpected countries: %+v, %v", countries, err)
+	}
+
+	countries, err = languages.Countries(context.Background(), "xx")
+	if err != nil || len(countries) != 0 {
+		t.Errorf("Expected no countries, got: %+v, %v", countries, err)
+	}
+}
+
+func TestHTTPCountries(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v3.1/alpha/NOR" {
+			w.Write([]byte(`[{"population": 5379475}]`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	pool := upstream.NewPool("restcountries", server.URL+"/v3.1", server.URL+"/v3.1/", "")
+	countries := NewHTTPCountries(server.Client(), pool)
+
+	population, err := countries.Population(context.Background(), "NOR")
+	if err != nil || population != 5379475 {
+		t.Errorf("Population() = %v, %v", population, err)
+	}
+
+	if _, err = countries.Population(context.Background(), "XXX"); err == nil {
+		t.Error("Expected error for unknown country")
+	}
+}
+
+func TestHTTPCountriesPopulations(t *testing.T) {
+	var requests int
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v3.1/alpha" || r.URL.Query().Get("codes") != "NOR,ISL" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`[{"cca3": "NOR", "population": 5379475}, {"cca3": "ISL", "population": 366425}]`))
+	})
+
+	pool := upstream.NewPool("restcountries", server.URL+"/v3.1", server.URL+"/v3.1/", "")
+	countries := NewHTTPCountries(server.Client(), pool)
+
+	populations, err := countries.Populations(context.Background(), []string{"NOR", "ISL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"NOR": 5379475, "ISL": 366425}
+	if !reflect.DeepEqual(populations, want) || requests != 1 {
+		t.Errorf("Populations() = %v in %v requests, want %v in 1 request", populations, requests, want)
+	}
+}
+
+func Test_chunkCodes(t *testing.T) {
+	codes := []string{"NOR", "ISL", "SJM", "SWE", "DNK"}
+
+	tests := []struct {
+		name      string
+		maxLength int
+		want      [][]string
+	}{
+		{"One chunk", 100, [][]string{codes}},
+		{"Two codes per chunk", len("NOR,ISL"), [][]string{{"NOR", "ISL"}, {"SJM", "SWE"}, {"DNK"}}},
+		{"One code per chunk", len("NOR,IS"), [][]string{{"NOR"}, {"ISL"}, {"SJM"}, {"SWE"}, {"DNK"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunkCodes(codes, tt.maxLength); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunkCodes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,641 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"prog2005assignment1/server/iso639"
+	"prog2005assignment1/server/shared"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables read by Load. PORT is kept without prefix, since it is set by Render.
+const (
+	EnvConfigFile             = "LIBRARYSTATS_CONFIG"
+	EnvPort                   = "PORT"
+	EnvBasePath               = "LIBRARYSTATS_BASE_PATH"
+	EnvGutendexApi            = "LIBRARYSTATS_GUTENDEX_API"
+	EnvGutendexApiRemote      = "LIBRARYSTATS_GUTENDEX_API_REMOTE"
+	EnvLanguageApi            = "LIBRARYSTATS_LANGUAGE_API"
+	EnvRestCountriesApi       = "LIBRARYSTATS_RESTCOUNTRIES_API"
+	EnvRestCountriesApiRemote = "LIBRARYSTATS_RESTCOUNTRIES_API_REMOTE"
+	EnvUpstreamTimeout        = "LIBRARYSTATS_UPSTREAM_TIMEOUT"
+	EnvLanguageCheckTimeout   = "LIBRARYSTATS_LANGUAGE_CHECK_TIMEOUT"
+	EnvLanguageCrossCheck     = "LIBRARYSTATS_LANGUAGE_CROSS_CHECK"
+	EnvHealthCheckInterval    = "LIBRARYSTATS_HEALTH_CHECK_INTERVAL"
+	EnvBookCountTimeout       = "LIBRARYSTATS_BOOKCOUNT_TIMEOUT"
+	EnvAuthorsTimeout         = "LIBRARYSTATS_AUTHORS_TIMEOUT"
+	EnvBooksTimeout           = "LIBRARYSTATS_BOOKS_TIMEOUT"
+	EnvSubjectsTimeout        = "LIBRARYSTATS_SUBJECTS_TIMEOUT"
+	EnvBookshelvesTimeout     = "LIBRARYSTATS_BOOKSHELVES_TIMEOUT"
+	EnvReadershipTimeout      = "LIBRARYSTATS_READERSHIP_TIMEOUT"
+	EnvStatusTimeout          = "LIBRARYSTATS_STATUS_TIMEOUT"
+	EnvCrawlTimeout           = "LIBRARYSTATS_CRAWL_TIMEOUT"
+	EnvGutendexConcurrency    = "LIBRARYSTATS_GUTENDEX_CONCURRENCY"
+	EnvCountriesConcurrency   = "LIBRARYSTATS_COUNTRIES_CONCURRENCY"
+	EnvCacheTTL               = "LIBRARYSTATS_CACHE_TTL"
+	EnvCacheMaxStale          = "LIBRARYSTATS_CACHE_MAX_STALE"
+	EnvCacheMaxBytes          = "LIBRARYSTATS_CACHE_MAX_BYTES"
+	EnvCacheDir               = "LIBRARYSTATS_CACHE_DIR"
+	EnvWarmupLanguages        = "LIBRARYSTATS_WARMUP_LANGUAGES"
+	EnvWarmupInterval         = "LIBRARYSTATS_WARMUP_INTERVAL"
+	EnvWarmupJitter           = "LIBRARYSTATS_WARMUP_JITTER"
+	EnvWarmupConcurrency      = "LIBRARYSTATS_WARMUP_CONCURRENCY"
+	EnvRetryMaxAttempts       = "LIBRARYSTATS_RETRY_MAX_ATTEMPTS"
+	EnvRetryDeadline          = "LIBRARYSTATS_RETRY_DEADLINE"
+	EnvBreakerThreshold       = "LIBRARYSTATS_BREAKER_THRESHOLD"
+	EnvBreakerOpenTimeout     = "LIBRARYSTATS_BREAKER_OPEN_TIMEOUT"
+)
+
+// Config struct, used to hold the runtime configuration of the server
+type Config struct {
+	Port                   string   `json:"port"`
+	BasePath               string   `json:"base_path"`
+	GutendexApi            string   `json:"gutendex_api"`
+	GutendexApiRemote      string   `json:"gutendex_api_remote"`
+	LanguageApi            string   `json:"language_api"`
+	RestCountriesApi       string   `json:"restcountries_api"`
+	RestCountriesApiRemote string   `json:"restcountries_api_remote"`
+	UpstreamTimeout        Duration `json:"upstream_timeout"`
+	LanguageCheckTimeout   Duration `json:"language_check_timeout"`
+	// Ask the Language2Country API as well as the embedded ISO 639 registry when validating a language, and log
+	// disagreements. The registry has the final say.
+	LanguageCrossCheck   bool     `json:"language_cross_check"`
+	HealthCheckInterval  Duration `json:"health_check_interval"`
+	BookCountTimeout     Duration `json:"bookcount_timeout"`
+	AuthorsTimeout       Duration `json:"authors_timeout"`
+	BooksTimeout         Duration `json:"books_timeout"`
+	SubjectsTimeout      Duration `json:"subjects_timeout"`
+	BookshelvesTimeout   Duration `json:"bookshelves_timeout"`
+	ReadershipTimeout    Duration `json:"readership_timeout"`
+	StatusTimeout        Duration `json:"status_timeout"`
+	GutendexConcurrency  int      `json:"gutendex_concurrency"`
+	CountriesConcurrency int      `json:"countries_concurrency"`
+	CacheTTL             Duration `json:"cache_ttl"`
+	CacheMaxStale        Duration `json:"cache_max_stale"`
+	CacheMaxBytes        int      `json:"cache_max_bytes"`
+	CacheDir             string   `json:"cache_dir"`
+	WarmupLanguages      []string `json:"warmup_languages"`
+	WarmupInterval       Duration `json:"warmup_interval"`
+	WarmupJitter         Duration `json:"warmup_jitter"`
+	WarmupConcurrency    int      `json:"warmup_concurrency"`
+	// Retry policy per upstream, keyed by shared.UpstreamGutendex, UpstreamLanguages and UpstreamRestCountries
+	Retry map[string]RetryPolicy `json:"retry"`
+	// Failures in a row before the circuit breaker of an upstream opens, and how long it stays open
+	BreakerThreshold   int      `json:"breaker_threshold"`
+	BreakerOpenTimeout Duration `json:"breaker_open_timeout"`
+	// Time limit of a crawl of all the books in a language, shared by the requests waiting for it. Longer than the
+	// endpoint timeouts, so a crawl outliving the request that started it still fills the cache.
+	CrawlTimeout Duration `json:"crawl_timeout"`
+}
+
+// RetryPolicy struct, used to configure how requests to an upstream are retried. Fields left out of the config file
+// keep their default, so a policy only has to list what it changes.
+type RetryPolicy struct {
+	MaxAttempts     int      `json:"max_attempts"`
+	BaseDelay       Duration `json:"base_delay"`
+	MaxDelay        Duration `json:"max_delay"`
+	Deadline        Duration `json:"deadline"`
+	RetryableStatus []int    `json:"retryable_status"`
+}
+
+// Duration struct, used to decode durations such as "3s" or "500ms" from the config file
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON
+/*
+Decode a duration from either a Go duration string ("3s") or a number of seconds (3).
+*/
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		d.Duration = time.Duration(v * float64(time.Second))
+		return nil
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+		return nil
+	default:
+		return errors.New("invalid duration " + string(data))
+	}
+}
+
+// MarshalJSON
+/*
+Encode a duration as a Go duration string, so a marshalled config can be loaded again.
+*/
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Default
+/*
+Return the default configuration, built from the constants in shared.
+*/
+func Default() *Config {
+	return &Config{
+		Port:                   shared.DefaultPort,
+		BasePath:               shared.LibraryStatsPath,
+		GutendexApi:            shared.GutendexApi,
+		GutendexApiRemote:      shared.GutendexApiRemote,
+		LanguageApi:            shared.LanguageApi,
+		RestCountriesApi:       shared.RestCountriesApi,
+		RestCountriesApiRemote: shared.RestCountriesApiRemote,
+		UpstreamTimeout:        Duration{3 * time.Second},
+		LanguageCheckTimeout:   Duration{1 * time.Second},
+		HealthCheckInterval:    Duration{30 * time.Second},
+		BookCountTimeout:       Duration{60 * time.Second},
+		AuthorsTimeout:         Duration{60 * time.Second},
+		BooksTimeout:           Duration{60 * time.Second},
+		SubjectsTimeout:        Duration{60 * time.Second},
+		BookshelvesTimeout:     Duration{60 * time.Second},
+		ReadershipTimeout:      Duration{30 * time.Second},
+		StatusTimeout:          Duration{5 * time.Second},
+		CrawlTimeout:           Duration{5 * time.Minute},
+		GutendexConcurrency:    4,
+		CountriesConcurrency:   8,
+		CacheTTL:               Duration{1 * time.Hour},
+		CacheMaxStale:          Duration{24 * time.Hour},
+		CacheMaxBytes:          64 << 20,
+		WarmupInterval:         Duration{6 * time.Hour},
+		WarmupJitter:           Duration{5 * time.Minute},
+		WarmupConcurrency:      2,
+		Retry:                  defaultRetry(),
+		BreakerThreshold:       5,
+		BreakerOpenTimeout:     Duration{30 * time.Second},
+	}
+}
+
+/*
+Return the default retry policies. Gutendex pages are slow, so its deadline is longer. The language API is called for
+every requested language, so its retries are quick.
+*/
+func defaultRetry() map[string]RetryPolicy {
+	retryable := []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout}
+
+	return map[string]RetryPolicy{
+		shared.UpstreamGutendex: {
+			MaxAttempts: 3, BaseDelay: Duration{250 * time.Millisecond}, MaxDelay: Duration{2 * time.Second},
+			Deadline: Duration{20 * time.Second}, RetryableStatus: retryable,
+		},
+		shared.UpstreamLanguages: {
+			MaxAttempts: 3, BaseDelay: Duration{100 * time.Millisecond}, MaxDelay: Duration{1 * time.Second},
+			Deadline: Duration{5 * time.Second}, RetryableStatus: retryable,
+		},
+		shared.UpstreamRestCountries: {
+			MaxAttempts: 3, BaseDelay: Duration{200 * time.Millisecond}, MaxDelay: Duration{2 * time.Second},
+			Deadline: Duration{10 * time.Second}, RetryableStatus: retryable,
+		},
+	}
+}
+
+// Load
+/*
+Load the configuration. Precedence, from lowest to highest:
+ 1. Defaults from shared
+ 2. The JSON config file named by $LIBRARYSTATS_CONFIG, if set
+ 3. Environment variables
+
+Returns an error describing every invalid setting if the resulting configuration is not valid.
+*/
+func Load() (*Config, error) {
+	cfg := Default()
+
+	if path := os.Getenv(EnvConfigFile); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	cfg.normalize()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+/*
+Overwrite the fields present in the JSON file at path. Fields not present in the file are left untouched.
+*/
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.New("could not open config file: " + err.Error())
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(c); err != nil {
+		return errors.New("could not decode config file " + path + ": " + err.Error())
+	}
+
+	return nil
+}
+
+/*
+Overwrite fields with the environment variables that are set.
+*/
+func (c *Config) loadEnv() error {
+	stringFields := map[string]*string{
+		EnvPort:                   &c.Port,
+		EnvBasePath:               &c.BasePath,
+		EnvGutendexApi:            &c.GutendexApi,
+		EnvGutendexApiRemote:      &c.GutendexApiRemote,
+		EnvLanguageApi:            &c.LanguageApi,
+		EnvRestCountriesApi:       &c.RestCountriesApi,
+		EnvRestCountriesApiRemote: &c.RestCountriesApiRemote,
+		EnvCacheDir:               &c.CacheDir,
+	}
+	for env, field := range stringFields {
+		if value := os.Getenv(env); value != "" {
+			*field = value
+		}
+	}
+
+	durationFields := map[string]*Duration{
+		EnvUpstreamTimeout:      &c.UpstreamTimeout,
+		EnvLanguageCheckTimeout: &c.LanguageCheckTimeout,
+		EnvHealthCheckInterval:  &c.HealthCheckInterval,
+		EnvBookCountTimeout:     &c.BookCountTimeout,
+		EnvAuthorsTimeout:       &c.AuthorsTimeout,
+		EnvBooksTimeout:         &c.BooksTimeout,
+		EnvSubjectsTimeout:      &c.SubjectsTimeout,
+		EnvBookshelvesTimeout:   &c.BookshelvesTimeout,
+		EnvReadershipTimeout:    &c.ReadershipTimeout,
+		EnvStatusTimeout:        &c.StatusTimeout,
+		EnvCrawlTimeout:         &c.CrawlTimeout,
+		EnvCacheTTL:             &c.CacheTTL,
+		EnvCacheMaxStale:        &c.CacheMaxStale,
+		EnvWarmupInterval:       &c.WarmupInterval,
+		EnvWarmupJitter:         &c.WarmupJitter,
+		EnvBreakerOpenTimeout:   &c.BreakerOpenTimeout,
+	}
+	for env, field := range durationFields {
+		if value := os.Getenv(env); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.New("invalid duration in $" + env + ": " + err.Error())
+			}
+			field.Duration = parsed
+		}
+	}
+
+	intFields := map[string]*int{
+		EnvGutendexConcurrency:  &c.GutendexConcurrency,
+		EnvCountriesConcurrency: &c.CountriesConcurrency,
+		EnvCacheMaxBytes:        &c.CacheMaxBytes,
+		EnvWarmupConcurrency:    &c.WarmupConcurrency,
+		EnvBreakerThreshold:     &c.BreakerThreshold,
+	}
+	for env, field := range intFields {
+		if value := os.Getenv(env); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.New("invalid number in $" + env + ": " + err.Error())
+			}
+			*field = parsed
+		}
+	}
+
+	// The retry settings in the environment apply to every upstream
+	if value := os.Getenv(EnvRetryMaxAttempts); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("invalid number in $" + EnvRetryMaxAttempts + ": " + err.Error())
+		}
+		c.updateRetry(func(policy *RetryPolicy) { policy.MaxAttempts = parsed })
+	}
+	if value := os.Getenv(EnvRetryDeadline); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("invalid duration in $" + EnvRetryDeadline + ": " + err.Error())
+		}
+		c.updateRetry(func(policy *RetryPolicy) { policy.Deadline = Duration{parsed} })
+	}
+
+	if value := os.Getenv(EnvLanguageCrossCheck); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("invalid boolean in $" + EnvLanguageCrossCheck + ": " + err.Error())
+		}
+		c.LanguageCrossCheck = parsed
+	}
+
+	// Comma separated list, e.g. "no,sv,da"
+	if value := os.Getenv(EnvWarmupLanguages); value != "" {
+		c.WarmupLanguages = strings.Split(value, ",")
+	}
+
+	return nil
+}
+
+/*
+Clean up values that are easy to get slightly wrong, e.g. a base path with a trailing slash.
+*/
+func (c *Config) normalize() {
+	c.BasePath = strings.TrimSpace(c.BasePath)
+	if c.BasePath != "" && !strings.HasPrefix(c.BasePath, "/") {
+		c.BasePath = "/" + c.BasePath
+	}
+	c.BasePath = strings.TrimRight(c.BasePath, "/")
+
+	languages := make([]string, 0, len(c.WarmupLanguages))
+	for _, language := range c.WarmupLanguages {
+		if language = strings.ToLower(strings.TrimSpace(language)); language != "" {
+			languages = append(languages, language)
+		}
+	}
+	c.WarmupLanguages = languages
+
+	// Fill in what the config file left out of the retry policies
+	if c.Retry == nil {
+		c.Retry = map[string]RetryPolicy{}
+	}
+	for name, defaults := range defaultRetry() {
+		policy, ok := c.Retry[name]
+		if !ok {
+			c.Retry[name] = defaults
+			continue
+		}
+		if policy.MaxAttempts == 0 {
+			policy.MaxAttempts = defaults.MaxAttempts
+		}
+		if policy.BaseDelay.Duration == 0 {
+			policy.BaseDelay = defaults.BaseDelay
+		}
+		if policy.MaxDelay.Duration == 0 {
+			policy.MaxDelay = defaults.MaxDelay
+		}
+		if policy.Deadline.Duration == 0 {
+			policy.Deadline = defaults.Deadline
+		}
+		if policy.RetryableStatus == nil {
+			policy.RetryableStatus = defaults.RetryableStatus
+		}
+		c.Retry[name] = policy
+	}
+}
+
+/*
+Apply update to the retry policy of every upstream.
+*/
+func (c *Config) updateRetry(update func(policy *RetryPolicy)) {
+	if c.Retry == nil {
+		c.Retry = map[string]RetryPolicy{}
+	}
+	for _, name := range []string{shared.UpstreamGutendex, shared.UpstreamLanguages, shared.UpstreamRestCountries} {
+		policy := c.Retry[name]
+		update(&policy)
+		c.Retry[name] = policy
+	}
+}
+
+// Validate
+/*
+Check that every setting is usable. All problems are reported in a single error, one per line.
+*/
+func (c *Config) Validate() error {
+	var problems []string
+
+	port, err := strconv.Atoi(c.Port)
+	if err != nil || port < 1 || port > 65535 {
+		problems = append(problems, "port must be a number between 1 and 65535, got '"+c.Port+"'")
+	}
+
+	if c.BasePath == "" {
+		problems = append(problems, "base path must not be empty or '/'")
+	}
+
+	urls := []struct {
+		name  string
+		value string
+	}{
+		{"gutendex_api", c.GutendexApi},
+		{"gutendex_api_remote", c.GutendexApiRemote},
+		{"language_api", c.LanguageApi},
+		{"restcountries_api", c.RestCountriesApi},
+		{"restcountries_api_remote", c.RestCountriesApiRemote},
+	}
+	for _, u := range urls {
+		parsed, err := url.ParseRequestURI(u.value)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			problems = append(problems, u.name+" must be an absolute http(s) URL, got '"+u.value+"'")
+		}
+	}
+
+	if c.UpstreamTimeout.Duration <= 0 {
+		problems = append(problems, "upstream_timeout must be positive, got "+c.UpstreamTimeout.String())
+	}
+	if c.LanguageCheckTimeout.Duration <= 0 {
+		problems = append(problems, "language_check_timeout must be positive, got "+c.LanguageCheckTimeout.String())
+	}
+
+	if c.HealthCheckInterval.Duration <= 0 {
+		problems = append(problems, "health_check_interval must be positive, got "+c.HealthCheckInterval.String())
+	}
+
+	timeouts := []struct {
+		name  string
+		value Duration
+	}{
+		{"bookcount_timeout", c.BookCountTimeout},
+		{"authors_timeout", c.AuthorsTimeout},
+		{"books_timeout", c.BooksTimeout},
+		{"subjects_timeout", c.SubjectsTimeout},
+		{"bookshelves_timeout", c.BookshelvesTimeout},
+		{"readership_timeout", c.ReadershipTimeout},
+		{"status_timeout", c.StatusTimeout},
+		{"crawl_timeout", c.CrawlTimeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value.Duration <= 0 {
+			problems = append(problems, timeout.name+" must be positive, got "+timeout.value.String())
+		}
+	}
+
+	if c.GutendexConcurrency < 1 {
+		problems = append(problems, "gutendex_concurrency must be at least 1, got "+strconv.Itoa(c.GutendexConcurrency))
+	}
+
+	if c.CountriesConcurrency < 1 {
+		problems = append(problems, "countries_concurrency must be at least 1, got "+strconv.Itoa(c.CountriesConcurrency))
+	}
+
+	if c.CacheTTL.Duration <= 0 {
+		problems = append(problems, "cache_ttl must be positive, got "+c.CacheTTL.String())
+	}
+	if c.CacheMaxStale.Duration < 0 {
+		problems = append(problems, "cache_max_stale must not be negative, got "+c.CacheMaxStale.String())
+	}
+	if c.CacheMaxBytes < 0 {
+		problems = append(problems, "cache_max_bytes must not be negative, got "+strconv.Itoa(c.CacheMaxBytes))
+	}
+
+	for _, language := range c.WarmupLanguages {
+		if len(language) != 2 || strings.Trim(language, "abcdefghijklmnopqrstuvwxyz") != "" {
+			problems = append(problems, "warmup_languages must be two letter language codes, got '"+language+"'")
+		} else if _, ok := iso639.Default().Lookup(language); !ok {
+			problems = append(problems, "warmup_languages must be known ISO 639-1 languages, got '"+language+"'")
+		}
+	}
+	if c.WarmupInterval.Duration < 0 {
+		problems = append(problems, "warmup_interval must not be negative, got "+c.WarmupInterval.String())
+	}
+	if c.WarmupJitter.Duration < 0 {
+		problems = append(problems, "warmup_jitter must not be negative, got "+c.WarmupJitter.String())
+	}
+	if c.WarmupConcurrency < 1 {
+		problems = append(problems, "warmup_concurrency must be at least 1, got "+strconv.Itoa(c.WarmupConcurrency))
+	}
+
+	if c.BreakerThreshold < 1 {
+		problems = append(problems, "breaker_threshold must be at least 1, got "+strconv.Itoa(c.BreakerThreshold))
+	}
+	if c.BreakerOpenTimeout.Duration <= 0 {
+		problems = append(problems, "breaker_open_timeout must be positive, got "+c.BreakerOpenTimeout.String())
+	}
+
+	names := make([]string, 0, len(c.Retry))
+	for name := range c.Retry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		problems = append(problems, c.Retry[name].validate("retry."+name)...)
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+// BookCountPath
+/*
+Return the path of the bookcount endpoint under the configured base path.
+*/
+func (c *Config) BookCountPath() string {
+	return c.BasePath + shared.BookCountEndpoint
+}
+
+// ReadershipPath
+/*
+Return the path of the readership endpoint under the configured base path.
+*/
+func (c *Config) ReadershipPath() string {
+	return c.BasePath + shared.ReadershipEndpoint
+}
+
+// StatusPath
+/*
+Return the path of the status endpoint under the configured base path.
+*/
+func (c *Config) StatusPath() string {
+	return c.BasePath + shared.StatusEndpoint
+}
+
+// JobsPath
+/*
+Return the path of the jobs endpoint under the configured base path.
+*/
+func (c *Config) JobsPath() string {
+	return c.BasePath + shared.JobsEndpoint
+}
+
+// AuthorsPath
+/*
+Return the path of the authors endpoint under the configured base path.
+*/
+func (c *Config) AuthorsPath() string {
+	return c.BasePath + shared.AuthorsEndpoint
+}
+
+// BooksPath
+/*
+Return the path of the books endpoint under the configured base path.
+*/
+func (c *Config) BooksPath() string {
+	return c.BasePath + shared.BooksEndpoint
+}
+
+// SubjectsPath
+/*
+Return the path of the subjects endpoint under the configured base path.
+*/
+func (c *Config) SubjectsPath() string {
+	return c.BasePath + shared.SubjectsEndpoint
+}
+
+// BookshelvesPath
+/*
+Return the path of the bookshelves endpoint under the configured base path.
+*/
+func (c *Config) BookshelvesPath() string {
+	return c.BasePath + shared.BookshelvesEndpoint
+}
+
+// LanguagesPath
+/*
+Return the path of the languages endpoint under the configured base path.
+*/
+func (c *Config) LanguagesPath() string {
+	return c.BasePath + shared.LanguagesEndpoint
+}
+
+/*
+Check that the policy is usable, and that it belongs to a known upstream. Problems are prefixed with name.
+*/
+func (p RetryPolicy) validate(name string) []string {
+	var problems []string
+
+	switch strings.TrimPrefix(name, "retry.") {
+	case shared.UpstreamGutendex, shared.UpstreamLanguages, shared.UpstreamRestCountries:
+	default:
+		return []string{name + " is not a known upstream, use " + shared.UpstreamGutendex + ", " +
+			shared.UpstreamLanguages + " or " + shared.UpstreamRestCountries}
+	}
+
+	if p.MaxAttempts < 1 {
+		problems = append(problems, name+".max_attempts must be at least 1, got "+strconv.Itoa(p.MaxAttempts))
+	}
+	if p.BaseDelay.Duration < 0 {
+		problems = append(problems, name+".base_delay must not be negative, got "+p.BaseDelay.String())
+	}
+	if p.MaxDelay.Duration < p.BaseDelay.Duration {
+		problems = append(problems, name+".max_delay must be at least base_delay, got "+p.MaxDelay.String())
+	}
+	if p.Deadline.Duration < 0 {
+		problems = append(problems, name+".deadline must not be negative, got "+p.Deadline.String())
+	}
+	for _, status := range p.RetryableStatus {
+		if status < 100 || status > 599 {
+			problems = append(problems, name+".retryable_status must be HTTP status codes, got "+strconv.Itoa(status))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"prog2005assignment1/server/shared"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	if cfg.Port != shared.DefaultPort {
+		t.Errorf("Expected port %v, got: %v", shared.DefaultPort, cfg.Port)
+	}
+
+	if cfg.BookCountPath() != shared.BookCountPath {
+		t.Errorf("Expected bookcount path %v, got: %v", shared.BookCountPath, cfg.BookCountPath())
+	}
+
+	if cfg.GutendexApi != shared.GutendexApi {
+		t.Errorf("Expected Gutendex API %v, got: %v", shared.GutendexApi, cfg.GutendexApi)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	// The file overrides the defaults, the environment overrides the file
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{
+		"port": "9000",
+		"base_path": "/stats/",
+		"gutendex_api": "https://gutendex.com/books/",
+		"upstream_timeout": "10s"
+	}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(EnvConfigFile, path)
+	t.Setenv(EnvPort, "9001")
+	t.Setenv(EnvLanguageCheckTimeout, "250ms")
+	t.Setenv(EnvWarmupLanguages, "no, SV,,da")
+	t.Setenv(EnvLanguageCrossCheck, "true")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	if cfg.Port != "9001" {
+		t.Errorf("Expected port from environment, got: %v", cfg.Port)
+	}
+
+	if cfg.BasePath != "/stats" {
+		t.Errorf("Expected normalized base path from file, got: %v", cfg.BasePath)
+	}
+
+	if cfg.ReadershipPath() != "/stats"+shared.ReadershipEndpoint {
+		t.Errorf("Unexpected readership path: %v", cfg.ReadershipPath())
+	}
+
+	if cfg.GutendexApi != "https://gutendex.com/books/" {
+		t.Errorf("Expected Gutendex API from file, got: %v", cfg.GutendexApi)
+	}
+
+	if cfg.UpstreamTimeout.Duration != 10*time.Second {
+		t.Errorf("Expected upstream timeout from file, got: %v", cfg.UpstreamTimeout)
+	}
+
+	if cfg.LanguageCheckTimeout.Duration != 250*time.Millisecond {
+		t.Errorf("Expected language check timeout from environment, got: %v", cfg.LanguageCheckTimeout)
+	}
+
+	if strings.Join(cfg.WarmupLanguages, ",") != "no,sv,da" {
+		t.Errorf("Expected normalized warm-up languages from environment, got: %v", cfg.WarmupLanguages)
+	}
+
+	if !cfg.LanguageCrossCheck {
+		t.Error("Expected language cross-check from environment")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		value   string
+		wantErr string
+	}{
+		{"Port not a number", EnvPort, "http", "port"},
+		{"Port out of range", EnvPort, "70000", "port"},
+		{"Relative URL", EnvGutendexApi, "books/", "gutendex_api"},
+		{"Unsupported scheme", EnvLanguageApi, "ftp://example.com/", "language_api"},
+		{"Base path root", EnvBasePath, "/", "base path"},
+		{"Invalid duration", EnvUpstreamTimeout, "soon", EnvUpstreamTimeout},
+		{"Negative duration", EnvLanguageCheckTimeout, "-1s", "language_check_timeout"},
+		{"Invalid number", EnvGutendexConcurrency, "many", EnvGutendexConcurrency},
+		{"No concurrency", EnvGutendexConcurrency, "0", "gutendex_concurrency"},
+		{"Negative max stale", EnvCacheMaxStale, "-1h", "cache_max_stale"},
+		{"Invalid warm-up language", EnvWarmupLanguages, "no,norsk", "warmup_languages"},
+		{"Unknown warm-up language", EnvWarmupLanguages, "no,xx", "warmup_languages"},
+		{"Invalid cross-check", EnvLanguageCrossCheck, "sometimes", EnvLanguageCrossCheck},
+		{"No warm-up concurrency", EnvWarmupConcurrency, "0", "warmup_concurrency"},
+		{"Negative retry attempts", EnvRetryMaxAttempts, "-1", "retry.gutendex.max_attempts"},
+		{"Invalid retry deadline", EnvRetryDeadline, "later", EnvRetryDeadline},
+		{"No bookcount timeout", EnvBookCountTimeout, "0s", "bookcount_timeout"},
+		{"No authors timeout", EnvAuthorsTimeout, "0s", "authors_timeout"},
+		{"No books timeout", EnvBooksTimeout, "0s", "books_timeout"},
+		{"No subjects timeout", EnvSubjectsTimeout, "0s", "subjects_timeout"},
+		{"No breaker threshold", EnvBreakerThreshold, "0", "breaker_threshold"},
+		{"No breaker open timeout", EnvBreakerOpenTimeout, "0s", "breaker_open_timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+
+			_, err := Load()
+			if err == nil {
+				t.Fatalf("Expected error for %v=%v", tt.env, tt.value)
+			}
+
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error mentioning %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"gutendex": "https://gutendex.com/books/"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvConfigFile, path)
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for unknown field in config file")
+	}
+}
+
+func TestLoadRetry(t *testing.T) {
+	// The file only changes some fields of one policy, the rest keeps the defaults
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"retry": {"languages": {"max_attempts": 5, "retryable_status": []}}}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvConfigFile, path)
+	t.Setenv(EnvRetryDeadline, "30s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	defaults := defaultRetry()
+	languages := cfg.Retry[shared.UpstreamLanguages]
+	if languages.MaxAttempts != 5 || len(languages.RetryableStatus) != 0 ||
+		languages.BaseDelay != defaults[shared.UpstreamLanguages].BaseDelay {
+		t.Errorf("Unexpected languages policy: %+v", languages)
+	}
+
+	for name, policy := range cfg.Retry {
+		if policy.Deadline.Duration != 30*time.Second {
+			t.Errorf("Expected deadline from environment for %v, got: %v", name, policy.Deadline)
+		}
+	}
+	if gutendex := cfg.Retry[shared.UpstreamGutendex]; gutendex.MaxAttempts != 3 || len(gutendex.RetryableStatus) != 4 {
+		t.Errorf("Expected default gutendex policy, got: %+v", gutendex)
+	}
+}
+
+func TestLoadRetryUnknownUpstream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"retry": {"gutenberg": {"max_attempts": 2}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvConfigFile, path)
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "retry.gutenberg") {
+		t.Errorf("Expected error for unknown upstream, got: %v", err)
+	}
+}
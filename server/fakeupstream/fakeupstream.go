@@ -0,0 +1,341 @@
+package fakeupstream
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"prog2005assignment1/server/shared"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Paths the fake APIs are served on
+const GutendexPath = "/books/"
+const LanguagePath = "/language2countries/"
+const RestCountriesPath = "/v3.1"
+
+// DefaultFixtures is the fixture directory, relative to the repository root
+const DefaultFixtures = "resources/test"
+
+// Page size of the fake Gutendex, the same as the real one
+const DefaultPageSize = 32
+
+// Server struct, a fake of the Gutendex, Language2Countries and RestCountries APIs, serving fixture files.
+// The fixture directory contains Gutendex pages named books_*.json, language2countries.json mapping two-letter
+// language codes to countries, and restcountries.json with a list of RestCountries country objects.
+type Server struct {
+	PageSize  int
+	books     []fixtureBook
+	languages map[string][]shared.Country
+	countries []fixtureCountry
+	mux       *http.ServeMux
+}
+
+/*
+A book from a books_*.json fixture. The raw JSON is served as is, so every field in the fixture reaches the client.
+*/
+type fixtureBook struct {
+	Id        int      `json:"id"`
+	Languages []string `json:"languages"`
+	raw       json.RawMessage
+}
+
+/*
+A country from restcountries.json, with the codes it can be looked up by.
+*/
+type fixtureCountry struct {
+	Cca2 string `json:"cca2"`
+	Cca3 string `json:"cca3"`
+	raw  json.RawMessage
+}
+
+// New
+/*
+Create a fake upstream server from the fixtures in dir.
+*/
+func New(dir string) (*Server, error) {
+	s := &Server{PageSize: DefaultPageSize}
+
+	if err := s.loadBooks(dir); err != nil {
+		return nil, err
+	}
+	if err := loadJSON(filepath.Join(dir, "language2countries.json"), &s.languages); err != nil {
+		return nil, err
+	}
+	if err := s.loadCountries(dir); err != nil {
+		return nil, err
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc(GutendexPath, s.handleBooks)
+	s.mux.HandleFunc(LanguagePath, s.handleLanguage)
+	s.mux.HandleFunc(RestCountriesPath+"/", s.handleCountries)
+
+	return s, nil
+}
+
+// NewTestServer
+/*
+Start a fake upstream from the fixtures in dir as an httptest.Server. The caller has to close it.
+*/
+func NewTestServer(dir string) (*httptest.Server, error) {
+	s, err := New(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return httptest.NewServer(s), nil
+}
+
+// ServeHTTP
+/*
+Serve requests to any of the fake APIs.
+*/
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+/*
+Load all books from the books_*.json fixtures, sorted by id to get stable pages.
+*/
+func (s *Server) loadBooks(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "books_*.json"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no books_*.json fixtures in " + dir)
+	}
+
+	for _, file := range files {
+		var page struct {
+			Results []json.RawMessage `json:"results"`
+		}
+		if err = loadJSON(file, &page); err != nil {
+			return err
+		}
+
+		for _, raw := range page.Results {
+			book := fixtureBook{raw: raw}
+			if err = json.Unmarshal(raw, &book); err != nil {
+				return errors.New("invalid book in " + file + ": " + err.Error())
+			}
+			s.books = append(s.books, book)
+		}
+	}
+
+	sort.Slice(s.books, func(i, j int) bool {
+		return s.books[i].Id < s.books[j].Id
+	})
+
+	return nil
+}
+
+/*
+Load the countries from restcountries.json.
+*/
+func (s *Server) loadCountries(dir string) error {
+	var raws []json.RawMessage
+	if err := loadJSON(filepath.Join(dir, "restcountries.json"), &raws); err != nil {
+		return err
+	}
+
+	for _, raw := range raws {
+		country := fixtureCountry{raw: raw}
+		if err := json.Unmarshal(raw, &country); err != nil {
+			return errors.New("invalid country in restcountries.json: " + err.Error())
+		}
+		s.countries = append(s.countries, country)
+	}
+
+	return nil
+}
+
+/*
+Serve /books/, supporting the languages, ids and page query parameters like Gutendex.
+*/
+func (s *Server) handleBooks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var books []json.RawMessage
+	for _, book := range s.books {
+		if matchesLanguages(book, query.Get("languages")) && matchesIds(book, query.Get("ids")) {
+			books = append(books, book.raw)
+		}
+	}
+
+	page := 1
+	if query.Get("page") != "" {
+		var err error
+		page, err = strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 || (page-1)*s.PageSize >= len(books) && page != 1 {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"detail": "Invalid page."}`))
+			return
+		}
+	}
+
+	start := (page - 1) * s.PageSize
+	end := start + s.PageSize
+	if end > len(books) {
+		end = len(books)
+	}
+
+	result := struct {
+		Count    int               `json:"count"`
+		Next     *string           `json:"next"`
+		Previous *string           `json:"previous"`
+		Results  []json.RawMessage `json:"results"`
+	}{Count: len(books), Results: []json.RawMessage{}}
+	result.Results = append(result.Results, books[start:end]...)
+
+	if end < len(books) {
+		next := pageURL(r, page+1)
+		result.Next = &next
+	}
+	if page > 1 {
+		previous := pageURL(r, page-1)
+		result.Previous = &previous
+	}
+
+	writeJSON(w, result)
+}
+
+/*
+Serve /language2countries/{code}. Unknown languages get 204, like the real API.
+*/
+func (s *Server) handleLanguage(w http.ResponseWriter, r *http.Request) {
+	code := strings.Trim(strings.TrimPrefix(r.URL.Path, LanguagePath), "/")
+
+	countries, ok := s.languages[strings.ToLower(code)]
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSON(w, countries)
+}
+
+/*
+Serve /v3.1/all, /v3.1/alpha/{code} and /v3.1/alpha?codes={code,...}, where code is an alpha-2 or alpha-3 code.
+*/
+func (s *Server) handleCountries(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, RestCountriesPath)
+
+	if path == "/all" {
+		var all []json.RawMessage
+		for _, country := range s.countries {
+			all = append(all, country.raw)
+		}
+		writeJSON(w, all)
+		return
+	}
+
+	// Batch lookup, /alpha?codes=NOR,ISL. Unknown codes are left out.
+	if path == "/alpha" && r.URL.Query().Get("codes") != "" {
+		var found []json.RawMessage
+		for _, code := range strings.Split(strings.ToUpper(r.URL.Query().Get("codes")), ",") {
+			for _, country := range s.countries {
+				if country.Cca3 == code || country.Cca2 == code {
+					found = append(found, country.raw)
+					break
+				}
+			}
+		}
+
+		if len(found) > 0 {
+			writeJSON(w, found)
+			return
+		}
+	}
+
+	if strings.HasPrefix(path, "/alpha/") {
+		code := strings.ToUpper(strings.Trim(strings.TrimPrefix(path, "/alpha/"), "/"))
+		for _, country := range s.countries {
+			if country.Cca3 == code || country.Cca2 == code {
+				writeJSON(w, []json.RawMessage{country.raw})
+				return
+			}
+		}
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(`{"status": 404, "message": "Not Found"}`))
+}
+
+/*
+Check if the book is in one of the comma separated languages. An empty list matches every book.
+*/
+func matchesLanguages(book fixtureBook, languages string) bool {
+	if languages == "" {
+		return true
+	}
+
+	for _, language := range strings.Split(languages, ",") {
+		for _, bookLanguage := range book.Languages {
+			if bookLanguage == language {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+Check if the book has one of the comma separated ids. An empty list matches every book.
+*/
+func matchesIds(book fixtureBook, ids string) bool {
+	if ids == "" {
+		return true
+	}
+
+	for _, id := range strings.Split(ids, ",") {
+		if id == strconv.Itoa(book.Id) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Build the URL of another page of the same query, pointing to the host the request was sent to.
+*/
+func pageURL(r *http.Request, page int) string {
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+
+	return "http://" + r.Host + r.URL.Path + "?" + query.Encode()
+}
+
+/*
+Decode the JSON file at path into target.
+*/
+func loadJSON(path string, target interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(data, target); err != nil {
+		return errors.New("invalid fixture " + path + ": " + err.Error())
+	}
+	return nil
+}
+
+/*
+Write value as JSON.
+*/
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("content-type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Println("Failed to write response: " + err.Error())
+	}
+}
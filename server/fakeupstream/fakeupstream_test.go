@@ -0,0 +1,203 @@
+package fakeupstream
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"prog2005assignment1/server/clients"
+	"prog2005assignment1/server/config"
+	"prog2005assignment1/server/handlers"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/upstream"
+	"reflect"
+	"testing"
+)
+
+// Fixture directory, relative to this package
+const testFixtures = "../../" + DefaultFixtures
+
+/*
+Start a fake upstream with a small page size, so the Norwegian fixture spans several pages.
+*/
+func newTestUpstream(t *testing.T) *httptest.Server {
+	s, err := New(testFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.PageSize = 5
+
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBooksPagination(t *testing.T) {
+	server := newTestUpstream(t)
+
+	var ids []int
+	next := server.URL + GutendexPath + "?languages=no"
+	for next != "" {
+		res, err := http.Get(next)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var page shared.GutendexResult
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if page.Count != 21 {
+			t.Errorf("Expected count 21, got: %v", page.Count)
+		}
+		for _, book := range page.Results {
+			ids = append(ids, book.Id)
+		}
+		next = page.Next
+	}
+
+	if len(ids) != 21 {
+		t.Errorf("Expected 21 books over all pages, got: %v", len(ids))
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Errorf("Expected books sorted by id, got %v before %v", ids[i-1], ids[i])
+		}
+	}
+}
+
+func TestBooksInvalidPage(t *testing.T) {
+	server := newTestUpstream(t)
+
+	res, err := http.Get(server.URL + GutendexPath + "?languages=ar&page=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %v, got: %v", http.StatusNotFound, res.StatusCode)
+	}
+}
+
+func TestLanguageAndCountries(t *testing.T) {
+	server := newTestUpstream(t)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"Known language", LanguagePath + "no", http.StatusOK},
+		{"Unknown language", LanguagePath + "xx", http.StatusNoContent},
+		{"Country by alpha-3", RestCountriesPath + "/alpha/NOR", http.StatusOK},
+		{"Country by alpha-2", RestCountriesPath + "/alpha/no", http.StatusOK},
+		{"Unknown country", RestCountriesPath + "/alpha/XXX", http.StatusNotFound},
+		{"All countries", RestCountriesPath + "/all", http.StatusOK},
+		{"Batch of countries", RestCountriesPath + "/alpha?codes=NOR,ISL,XXX", http.StatusOK},
+		{"Batch of unknown countries", RestCountriesPath + "/alpha?codes=XXX", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %v, got: %v", tt.wantStatus, res.StatusCode)
+			}
+		})
+	}
+}
+
+// TestHandlersAgainstFakeUpstream runs the endpoints with the real HTTP clients against the fake upstream
+func TestHandlersAgainstFakeUpstream(t *testing.T) {
+	server := newTestUpstream(t)
+
+	cfg := config.Default()
+	cfg.GutendexApi = server.URL + GutendexPath
+	cfg.LanguageApi = server.URL + LanguagePath
+	cfg.RestCountriesApi = server.URL + RestCountriesPath
+
+	client := server.Client()
+	handler := handlers.New(cfg,
+		clients.NewHTTPGutendex(client, upstream.NewPool("gutendex", cfg.GutendexApi, cfg.GutendexApi, "")),
+		clients.NewHTTPLanguages(client, client, cfg.LanguageApi),
+		clients.NewHTTPCountries(client, upstream.NewPool("restcountries", cfg.RestCountriesApi, cfg.RestCountriesApi, "")),
+	)
+
+	rr := httptest.NewRecorder()
+	handler.BookCountHandler(rr, httptest.NewRequest(http.MethodGet, cfg.BookCountPath()+"?language=no,ar", nil))
+
+	var bookCounts []shared.BookCount
+	if err := json.NewDecoder(rr.Body).Decode(&bookCounts); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	wantBookCounts := []shared.BookCount{
+		{Language: "no", Input: "no", Books: 21, Authors: 16, Fraction: 0.95454},
+		{Language: "ar", Input: "ar", Books: 1, Authors: 1, Fraction: 0.04545},
+	}
+	if !reflect.DeepEqual(bookCounts, wantBookCounts) {
+		t.Errorf("Unexpected book counts: got %+v want %+v", bookCounts, wantBookCounts)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ReadershipHandler(rr, httptest.NewRequest(http.MethodGet, cfg.ReadershipPath()+"ar?limit=2", nil))
+
+	var readerships []shared.Readership
+	if err := json.NewDecoder(rr.Body).Decode(&readerships); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	wantReaderships := []shared.Readership{
+		{Country: "Egypt", Isocode: "EG", Language: "ar", Input: "ar", Books: 1, Authors: 1, Readership: population(102334403)},
+		{Country: "Jordan", Isocode: "JO", Language: "ar", Input: "ar", Books: 1, Authors: 1, Readership: population(10203140)},
+	}
+	if !reflect.DeepEqual(readerships, wantReaderships) {
+		t.Errorf("Unexpected readerships: got %+v want %+v", readerships, wantReaderships)
+	}
+
+	// The full Gutendex schema reaches the books listing, e.g. subjects and copyright
+	rr = httptest.NewRecorder()
+	handler.BooksHandler(rr, httptest.NewRequest(http.MethodGet, cfg.BooksPath()+
+		"?language=no&author=hamsun&subject=fiction&copyright=false&sort=title", nil))
+
+	var page shared.BookPage
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if page.Total != 3 || len(page.Books) != 3 || page.Books[0].Title != "Markens grøde, Anden del" ||
+		page.Books[2].Title != "Sult" || page.Books[2].Bookshelves[0] != "Best Books Ever Listings" ||
+		page.Books[2].MediaType != "Text" {
+		t.Errorf("Unexpected books: %+v", page)
+	}
+
+	// Unknown years of translators stay unknown, instead of becoming 0
+	rr = httptest.NewRecorder()
+	handler.BooksHandler(rr, httptest.NewRequest(http.MethodGet, cfg.BooksPath()+"?language=no&title=onkel", nil))
+
+	page = shared.BookPage{}
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(page.Books) != 1 {
+		t.Fatalf("Expected a single book, got: %+v", page)
+	}
+	book := page.Books[0]
+	if len(book.Translators) != 1 || book.Translators[0].Name != "Flæten, O." || book.Translators[0].BirthYear != nil ||
+		book.Authors[0].BirthYear == nil || book.DownloadCount == 0 || book.Formats["application/epub+zip"] == "" {
+		t.Errorf("Unexpected book: %+v", book)
+	}
+}
+
+/*
+Return a pointer to the population, for comparing with shared.Readership.
+*/
+func population(p int) *int {
+	return &p
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sort keys and orders of /authors
+const (
+	authorsSortBooks     = "books"
+	authorsSortName      = "name"
+	authorsSortBirthYear = "birthyear"
+	orderAsc             = "asc"
+	orderDesc            = "desc"
+)
+
+// Default and largest number of authors on a page of /authors
+const (
+	defaultAuthorsLimit = 100
+	maxAuthorsLimit     = 1000
+)
+
+// AuthorsHandler
+/*
+Handle requests for /authors, only GET requests are supported.
+*/
+func (h *Handler) AuthorsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleAuthorsGetRequest(w, r)
+	default:
+		util.WriteMethodNotSupported(w, r)
+		return
+	}
+}
+
+/*
+Handle GET request for /authors/{language}, returning a page of the unique authors of books in the language, with the
+number of books by each. Authors are the same as counted by bookcount, see authorKey.
+*/
+func (h *Handler) handleAuthorsGetRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("content-type", "application/json")
+
+	// Get the language from the path, cut off .../authors/
+	languageInput := strings.Split(strings.TrimPrefix(r.URL.Path, h.Config.AuthorsPath()), "/")[0]
+	twoLetterLanguageCode, ok := util.ResolveLanguage(r.Context(), h.crossCheck(), languageInput)
+	if !ok {
+		util.WriteProblemDetails(w, util.LanguageProblem(r, languageInput, "language"))
+		return
+	}
+
+	page := shared.AuthorPage{Language: twoLetterLanguageCode, Input: languageInput}
+	if !parseAuthorsPage(w, r, &page) {
+		return
+	}
+
+	mp, freshness, err := h.getLanguageBooks(r.Context(), twoLetterLanguageCode)
+	if err != nil {
+		log.Println("Error during rebuilding of full result: " + err.Error())
+		util.UpstreamError(w, r, err, shared.UpstreamGutendex, "Error during rebuilding of full result",
+			http.StatusBadGateway)
+		return
+	}
+
+	authors := collectAuthors(mp.Results)
+	sortAuthors(authors, page.Sort, page.Order == orderDesc)
+
+	// Cut out the requested page, pages past the last are empty
+	page.Total = len(authors)
+	start := (page.Page - 1) * page.Limit
+	if start > len(authors) {
+		start = len(authors)
+	}
+	end := start + page.Limit
+	if end > len(authors) {
+		end = len(authors)
+	}
+	page.Authors = append(make([]shared.Author, 0, end-start), authors[start:end]...)
+	page.Stale = freshness.Stale
+	setFreshnessHeaders(w, []Freshness{freshness})
+
+	marshaledPage, err := json.MarshalIndent(page, "", "\t")
+	if err != nil {
+		log.Println("Error during JSON encoding: " + err.Error())
+		util.WriteProblem(w, r, util.InternalError, "Error during JSON encoding.")
+		return
+	}
+
+	_, err = w.Write(marshaledPage)
+	if err != nil {
+		log.Println("Failed to write response: " + err.Error())
+	}
+}
+
+/*
+Read the sort, order, page and limit parameters of the request into page. Sorting is by books, descending, unless
+given. Order defaults to descending for books and ascending otherwise. Writes the problem and returns false if a
+parameter is invalid.
+*/
+func parseAuthorsPage(w http.ResponseWriter, r *http.Request, page *shared.AuthorPage) bool {
+	query := r.URL.Query()
+
+	page.Sort = query.Get("sort")
+	switch page.Sort {
+	case "":
+		page.Sort = authorsSortBooks
+	case authorsSortBooks, authorsSortName, authorsSortBirthYear:
+	default:
+		util.WriteProblem(w, r, util.InvalidParameter, "Invalid sort '"+page.Sort+"'. Please specify "+
+			authorsSortBooks+", "+authorsSortName+" or "+authorsSortBirthYear+".", util.Parameter("sort"))
+		return false
+	}
+
+	page.Order = query.Get("order")
+	switch page.Order {
+	case "":
+		page.Order = orderAsc
+		if page.Sort == authorsSortBooks {
+			page.Order = orderDesc
+		}
+	case orderAsc, orderDesc:
+	default:
+		util.WriteProblem(w, r, util.InvalidParameter, "Invalid order '"+page.Order+"'. Please specify "+orderAsc+
+			" or "+orderDesc+".", util.Parameter("order"))
+		return false
+	}
+
+	page.Page = 1
+	if pageStr := query.Get("page"); pageStr != "" {
+		var err error
+		page.Page, err = strconv.Atoi(pageStr)
+		if err != nil || page.Page < 1 {
+			util.WriteProblem(w, r, util.InvalidParameter, "Invalid page specified. Please specify a positive integer.",
+				util.Parameter("page"))
+			return false
+		}
+	}
+
+	page.Limit = defaultAuthorsLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		page.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || page.Limit < 1 || page.Limit > maxAuthorsLimit {
+			util.WriteProblem(w, r, util.InvalidParameter, "Invalid limit specified. Please specify an integer from 1 "+
+				"to "+strconv.Itoa(maxAuthorsLimit)+".", util.Parameter("limit"))
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+Sort the authors by books, name or birth year, in ascending or descending order. Authors with an unknown birth year
+come last either way when sorting by birth year. Ties are broken by name, then birth year, so pages are stable.
+*/
+func sortAuthors(authors []shared.Author, by string, desc bool) {
+	sort.SliceStable(authors, func(i, j int) bool {
+		a, b := authors[i], authors[j]
+		switch by {
+		case authorsSortBooks:
+			if a.Books != b.Books {
+				return (a.Books < b.Books) != desc
+			}
+		case authorsSortBirthYear:
+			if (a.BirthYear == nil) != (b.BirthYear == nil) {
+				return b.BirthYear == nil
+			}
+			if a.BirthYear != nil && *a.BirthYear != *b.BirthYear {
+				return (*a.BirthYear < *b.BirthYear) != desc
+			}
+		case authorsSortName:
+			if a.Name != b.Name {
+				return (a.Name < b.Name) != desc
+			}
+		}
+		return authorLess(a, b)
+	})
+}
+
+/*
+Get whether author a comes before b by name, then birth year, then death year. Unknown years come last.
+*/
+func authorLess(a shared.Author, b shared.Author) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	if less, ok := yearLess(a.BirthYear, b.BirthYear); ok {
+		return less
+	}
+	less, _ := yearLess(a.DeathYear, b.DeathYear)
+	return less
+}
+
+/*
+Compare two years, unknown years last. Returns false for ok if they are equal.
+*/
+func yearLess(a *int, b *int) (less bool, ok bool) {
+	switch {
+	case a == nil && b == nil:
+		return false, false
+	case a == nil || b == nil:
+		return b == nil, true
+	case *a != *b:
+		return *a < *b, true
+	default:
+		return false, false
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+	"testing"
+)
+
+/*
+Get a page of authors from the handler, failing the test unless it succeeds.
+*/
+func getAuthorPage(t *testing.T, handler *Handler, path string) shared.AuthorPage {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	handler.AuthorsHandler(rr, httptest.NewRequest(http.MethodGet, shared.AuthorsPath+path, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var page shared.AuthorPage
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return page
+}
+
+func TestAuthorsHandler(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	// By default the authors with the most books come first
+	page := getAuthorPage(t, handler, "no")
+	if page.Language != "no" || page.Total != 2 || page.Page != 1 || page.Sort != "books" || page.Order != "desc" {
+		t.Errorf("Unexpected page: %+v", page)
+	}
+	if len(page.Authors) != 2 {
+		t.Fatalf("Expected 2 authors, got: %+v", page.Authors)
+	}
+	hamsun := page.Authors[0]
+	if hamsun.Name != "Hamsun, Knut" || hamsun.Books != 2 || hamsun.BirthYear == nil || *hamsun.BirthYear != 1859 ||
+		hamsun.DeathYear == nil || *hamsun.DeathYear != 1952 {
+		t.Errorf("Unexpected author: %+v", hamsun)
+	}
+	if page.Authors[1].Name != "Ibsen, Henrik" || page.Authors[1].Books != 1 {
+		t.Errorf("Unexpected author: %+v", page.Authors[1])
+	}
+}
+
+func TestAuthorsHandlerSort(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	page := getAuthorPage(t, handler, "Norwegian?sort=birthyear")
+	if page.Input != "Norwegian" || page.Order != "asc" || len(page.Authors) != 2 ||
+		page.Authors[0].Name != "Ibsen, Henrik" {
+		t.Errorf("Unexpected page: %+v", page)
+	}
+
+	page = getAuthorPage(t, handler, "no?sort=name&order=desc")
+	if len(page.Authors) != 2 || page.Authors[0].Name != "Ibsen, Henrik" {
+		t.Errorf("Unexpected page: %+v", page)
+	}
+}
+
+func TestAuthorsHandlerPages(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	// 5 Latin authors, the pages follow each other in name order
+	var names []string
+	for _, path := range []string{"la?sort=name&limit=2", "la?sort=name&limit=2&page=2", "la?sort=name&limit=2&page=3"} {
+		page := getAuthorPage(t, handler, path)
+		if page.Total != 5 || page.Limit != 2 {
+			t.Errorf("Unexpected page: %+v", page)
+		}
+		for _, author := range page.Authors {
+			if author.Books != testLatinBooks/5 || author.BirthYear != nil {
+				t.Errorf("Unexpected author: %+v", author)
+			}
+			names = append(names, author.Name)
+		}
+	}
+	if len(names) != 5 || names[0] != "Latin author 0" || names[4] != "Latin author 4" {
+		t.Errorf("Unexpected authors: %v", names)
+	}
+
+	// Past the last page is empty
+	if page := getAuthorPage(t, handler, "la?limit=2&page=4"); page.Authors == nil || len(page.Authors) != 0 {
+		t.Errorf("Expected an empty page, got: %+v", page.Authors)
+	}
+}
+
+func TestAuthorsHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		wantProblem   util.ProblemType
+		wantParameter string
+	}{
+		{"Unknown language", http.MethodGet, "xx", util.UnknownLanguage, "language"},
+		{"Invalid language", http.MethodGet, "n0", util.InvalidParameter, "language"},
+		{"Misspelled language", http.MethodGet, "Norwegain", util.UnknownLanguage, "language"},
+		{"Invalid sort", http.MethodGet, "no?sort=title", util.InvalidParameter, "sort"},
+		{"Invalid order", http.MethodGet, "no?order=up", util.InvalidParameter, "order"},
+		{"Invalid page", http.MethodGet, "no?page=0", util.InvalidParameter, "page"},
+		{"Invalid limit", http.MethodGet, "no?limit=1001", util.InvalidParameter, "limit"},
+		{"Unsupported method", http.MethodPost, "no", util.MethodNotSupported, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, _, _, _ := newTestHandler()
+
+			rr := httptest.NewRecorder()
+			util.Guard(handler.AuthorsHandler)(rr, httptest.NewRequest(tt.method, shared.AuthorsPath+tt.path, nil))
+
+			assertProblem(t, rr, tt.wantProblem, tt.wantParameter, "")
+		})
+	}
+}
+
+func Test_collectAuthors(t *testing.T) {
+	hamsun := shared.Person{Name: "Hamsun, Knut", BirthYear: year(1859), DeathYear: year(1952)}
+	namesake := shared.Person{Name: "Hamsun, Knut"}
+
+	// The same name with other years is another author, and an author listed twice wrote the book once
+	authors := collectAuthors([]shared.Book{
+		{Id: 1, Authors: []shared.Person{hamsun, hamsun}},
+		{Id: 2, Authors: []shared.Person{hamsun, namesake}},
+		{Id: 3},
+	})
+	if len(authors) != 2 || authors[0].Books != 2 || authors[1].Books != 1 || authors[1].BirthYear != nil {
+		t.Errorf("Unexpected authors: %+v", authors)
+	}
+}
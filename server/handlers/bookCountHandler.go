@@ -1,28 +1,34 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"net/url"
+	"prog2005assignment1/server/cache"
 	"prog2005assignment1/server/shared"
 	"prog2005assignment1/server/util"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// Key of the total number of books in the cache and on disk, apart from the two-letter codes of the languages
+const totalKey = "total"
+
 // BookCountHandler
 /*
 Handle requests for /bookCount
 */
-func BookCountHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) BookCountHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		handleBookCountGetRequest(w, r)
+		h.handleBookCountGetRequest(w, r)
 	default:
-		http.Error(w, "REST Method '"+r.Method+"' not supported. Currently only '"+http.MethodGet+
-			"' are supported.", http.StatusNotImplemented)
+		util.WriteMethodNotSupported(w, r)
 		return
 	}
 
@@ -31,20 +37,44 @@ func BookCountHandler(w http.ResponseWriter, r *http.Request) {
 /*
 Handle GET request for /bookCount
 */
-func handleBookCountGetRequest(w http.ResponseWriter, r *http.Request) {
-	defer client.CloseIdleConnections()
+func (h *Handler) handleBookCountGetRequest(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("content-type", "application/json")
 
 	/*
 		Method works by making a "starter" requests to the Gutendex API,
-		then rebuilding the full result from the "next" field in the response.
+		then rebuilding the full result from the remaining pages, fetched in parallel.
 	*/
 
 	// Uses /?language={:two_letter_language_code+}/
 	languageQuery := r.URL.Query().Get("language")
 	if languageQuery == "" {
 		log.Println("No language specified.")
-		http.Error(w, "No language specified. See documentation (README).", http.StatusBadRequest)
+		util.WriteProblem(w, r, util.InvalidParameter, "No language specified. See documentation (README).",
+			util.Parameter("language"))
+		return
+	}
+
+	// Envelope mode reports the book counts and the errors apart, so partial success is explicit
+	envelope := false
+	if envelopeQuery := r.URL.Query().Get("envelope"); envelopeQuery != "" {
+		var err error
+		envelope, err = strconv.ParseBool(envelopeQuery)
+		if err != nil {
+			util.WriteProblem(w, r, util.InvalidParameter, "Invalid envelope '"+envelopeQuery+
+				"'. Please specify true or false.", util.Parameter("envelope"))
+			return
+		}
+	}
+
+	// With group=macro, the members of a macrolanguage are counted together, e.g. sh, bs, hr and sr
+	macro, ok := parseGroup(w, r)
+	if !ok {
+		return
+	}
+
+	// With include=downloads, the download statistics and the top most downloaded books are added
+	top, ok := parseInclude(w, r)
+	if !ok {
 		return
 	}
 
@@ -54,105 +84,218 @@ func handleBookCountGetRequest(w http.ResponseWriter, r *http.Request) {
 	// Remove duplicates from languageQueries
 	languageQueries = removeDuplicates(languageQueries)
 
-	// Array of responses, one for each language. These will be used to rebuild the full result from the "next" field.
-	var validResponses []*http.Response
-	var validLanguages []string
+	// One result for each requested language, in the requested order. Languages that fail get an error instead of a
+	// book count, the other languages are still counted.
+	results := make([]shared.BookCountResult, 0, len(languageQueries))
+	var failures []languageFailure
+	fail := func(i int, problem shared.Problem, retryAfter int) {
+		results[i].Error = &problem
+		failures = append(failures, languageFailure{problem: problem, retryAfter: retryAfter})
+	}
+	failUpstream := func(i int, err error, upstreamName string, detail string, status int) {
+		problem, retryAfter := util.UpstreamProblem(r, err, upstreamName, detail, status)
+		fail(i, problem, retryAfter)
+	}
 
-	for _, language := range languageQueries {
-		if util.LanguageCodeChecker(language, w) {
-			// Store valid responses and languages
-			validResponses = append(validResponses, makeGutendexRequest(w, r, language))
-			validLanguages = append(validLanguages, language)
-		} else {
-			// Language is invalid, do nothing
+	// Languages may also be given as three letter codes or names, e.g. "nor" or "Norwegian". Languages resolving to
+	// the same code as an earlier one are only counted once.
+	var validLanguages []int
+	groups := map[int][]string{}
+	resolved := map[string]bool{}
+	for _, input := range languageQueries {
+		code, ok := util.ResolveLanguage(r.Context(), h.crossCheck(), input)
+		if !ok {
+			results = append(results, shared.BookCountResult{BookCount: shared.BookCount{Language: input}})
+			fail(len(results)-1, util.LanguageProblem(r, input, "language"), 0)
+			continue
 		}
-	}
+		group := languageGroup(code, macro)
+		if resolved[group[0]] {
+			continue
+		}
+		resolved[group[0]] = true
 
-	// If all languages are invalid, return error
-	if len(validResponses) == 0 {
-		http.Error(w, "Invalid language code. Please specify one or more valid two letter language codes.",
-			http.StatusBadRequest)
-		return
+		results = append(results, shared.BookCountResult{BookCount: shared.BookCount{Language: group[0],
+			Input: input}})
+		validLanguages = append(validLanguages, len(results)-1)
+		groups[len(results)-1] = group
 	}
 
 	// Get total book count from Gutendex API, used to calculate fraction.
-	// Since the library is always adding new books, the total book count is not constant.
-	totalBooks := getTotalBookCount(w)
-
-	// Array of bookCount structs
-	bookCounts := make([]shared.BookCount, len(validResponses))
+	// Since the library is always adding new books, the total book count is not constant. It is cached like the
+	// books, so cached languages are still counted while Gutendex is down, against the last known total.
+	totalBooks := 0
+	var totalFreshness Freshness
+	if len(validLanguages) > 0 {
+		var err error
+		totalBooks, totalFreshness, err = h.getTotal(r.Context())
+		if err != nil {
+			log.Println("Error when getting total book count: " + err.Error())
+			util.UpstreamError(w, r, err, shared.UpstreamGutendex, "Error when getting total book count from Gutendex",
+				http.StatusBadGateway)
+			return
+		}
+	}
 
-	// Iterate over responses and decode JSON
-	for i, res := range validResponses {
-		// If response is nil, continue, this happens if the language is invalid
-		if res == nil {
+	freshnesses := make([]Freshness, 0, len(validLanguages))
+	for _, i := range validLanguages {
+		language := results[i].Language
+		var members []shared.BookCount
+		var authors, books int
+		var freshness Freshness
+		var err error
+		if macro {
+			authors, books, members, freshness, err = h.GetGroupAuthorsAndBooks(r.Context(), groups[i])
+			for j := range members {
+				members[j].Fraction = fraction(members[j].Books, totalBooks)
+			}
+		} else {
+			authors, books, freshness, err = h.GetAuthorsAndBooks(r.Context(), language)
+		}
+		if err != nil {
+			log.Println("Error during rebuilding of full result for " + language + ": " + err.Error())
+			failUpstream(i, err, shared.UpstreamGutendex, "Error during rebuilding of full result",
+				http.StatusBadGateway)
 			continue
 		}
 
-		decodedGutendexResponse := decodeJSON(w, res)
-
-		// If no books found for language, create an artificial bookCount struct and continue
-		// This is done to simplify the code, as calculating the fraction and unique authors would be a waste
-		if decodedGutendexResponse.Count == 0 {
-			bookCount := shared.BookCount{
-				Language: validLanguages[i],
-				Books:    0,
-				Authors:  0,
-				Fraction: 0,
+		// The books were just counted, so they are served from the cache
+		var downloads *shared.Downloads
+		if top >= 0 {
+			groupBooks, _, err := h.getBooks(r.Context(), groups[i])
+			if err != nil {
+				log.Println("Error when getting downloads of " + language + ": " + err.Error())
+				failUpstream(i, err, shared.UpstreamGutendex, "Error during rebuilding of full result",
+					http.StatusBadGateway)
+				continue
 			}
-
-			bookCounts[i] = bookCount
-
-			continue
+			languageDownloads := getDownloads(groupBooks, top)
+			downloads = &languageDownloads
 		}
 
-		var rebuildError error
-		decodedGutendexResponse, rebuildError = rebuildFullGutendexResult(w, decodedGutendexResponse)
-		if rebuildError != nil {
-			log.Println("Error during rebuilding of full result: " + rebuildError.Error())
-			http.Error(w, "Error during rebuilding of full result", http.StatusInternalServerError)
-			return
+		results[i].BookCount = shared.BookCount{
+			Language:  language,
+			Input:     results[i].Input,
+			Books:     books,
+			Authors:   authors,
+			Fraction:  fraction(books, totalBooks),
+			Downloads: downloads,
+			Stale:     freshness.Stale || totalFreshness.Stale,
+			Members:   members,
 		}
+		freshnesses = append(freshnesses, freshness)
+	}
+	if len(freshnesses) > 0 {
+		freshnesses = append(freshnesses, totalFreshness)
+	}
 
-		output := prettyPrintJSON(w, decodedGutendexResponse)
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		log.Println("Client went away, not writing response")
+		return
+	}
 
-		booksOfLanguage := decodedGutendexResponse.Count
-		fraction := float64(booksOfLanguage) / float64(totalBooks)
+	// A single language that failed is the problem of the whole request. When several languages all failed, every
+	// error is still reported, with a status summing up the failures.
+	status := http.StatusOK
+	if len(failures) == len(results) {
+		for _, failure := range failures {
+			if failure.retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(failure.retryAfter))
+				break
+			}
+		}
+		if len(results) == 1 {
+			util.WriteProblemDetails(w, failures[0].problem)
+			return
+		}
+		status = failureStatus(failures)
+	}
+	setFreshnessHeaders(w, freshnesses)
 
-		// Make fraction 5 decimal places
-		// Works by multiplying by 100000, converting to int, this will truncate the decimal places, then dividing by 100000
-		// This will make the fraction 5 decimal places
-		fraction = float64(int(fraction*100000)) / 100000
+	// Marshal and write to response
+	var body interface{} = results
+	if envelope {
+		body = newBookCountEnvelope(results)
+	}
+	marshaledBookCount, err := json.MarshalIndent(body, "", "\t")
+	if err != nil {
+		log.Println("Error during JSON encoding: " + err.Error())
+		util.WriteProblem(w, r, util.InternalError, "Error during JSON encoding.")
+		return
+	}
 
-		uniqueAuthors := getUniqueAuthors(w, output)
+	w.WriteHeader(status)
+	_, err = w.Write(marshaledBookCount)
+	if err != nil {
+		log.Println("Failed to write response: " + err.Error())
+	}
+}
 
-		bookCount := shared.BookCount{
-			Language: validLanguages[i],
-			Books:    booksOfLanguage,
-			Authors:  uniqueAuthors,
-			Fraction: fraction,
+/*
+Get the status of a response where every language failed: the status of the failures if they all have the same,
+400 Bad Request if they are all client errors, otherwise 502 Bad Gateway, since an upstream failed.
+*/
+func failureStatus(failures []languageFailure) int {
+	status := failures[0].problem.Status
+	clientErrors := true
+	for _, failure := range failures {
+		if failure.problem.Status != status {
+			status = 0
 		}
+		clientErrors = clientErrors && failure.problem.Status < http.StatusInternalServerError
+	}
 
-		bookCounts[i] = bookCount
+	switch {
+	case status != 0:
+		return status
+	case clientErrors:
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
 	}
+}
 
-	// Remove empty elements from bookCounts
-	bookCounts = removeEmptyElements(bookCounts)
+// languageFailure struct, the error for a requested language, and when to retry if its upstream is failing fast
+type languageFailure struct {
+	problem    shared.Problem
+	retryAfter int
+}
 
-	// Marshal and write to response
-	marshaledBookCount, err := json.MarshalIndent(bookCounts, "", "\t")
-	if err != nil {
-		log.Println("Error during JSON encoding: " + err.Error())
-		http.Error(w, "Error during JSON encoding.", http.StatusInternalServerError)
-		return
+/*
+Split the results into the book counts and the errors of the envelope.
+*/
+func newBookCountEnvelope(results []shared.BookCountResult) shared.BookCountEnvelope {
+	envelope := shared.BookCountEnvelope{
+		Results: make([]shared.BookCount, 0, len(results)),
+		Errors:  make([]shared.LanguageError, 0),
 	}
+	for _, result := range results {
+		if result.Error != nil {
+			envelope.Errors = append(envelope.Errors, shared.LanguageError{Language: result.Language,
+				Error: *result.Error})
+			continue
+		}
+		envelope.Results = append(envelope.Results, result.BookCount)
+	}
+	envelope.Partial = len(envelope.Errors) > 0 && len(envelope.Results) > 0
 
-	_, err6 := w.Write(marshaledBookCount)
-	if err6 != nil {
-		log.Println("Failed to write response: " + err6.Error())
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
-		return
+	return envelope
+}
+
+/*
+Calculate the fraction of books in the library, truncated to 5 decimal places. Returns 0 for an empty library.
+*/
+func fraction(books int, totalBooks int) float64 {
+	if totalBooks == 0 {
+		return 0
 	}
+
+	fraction := float64(books) / float64(totalBooks)
+
+	// Make fraction 5 decimal places
+	// Works by multiplying by 100000, converting to int, this will truncate the decimal places, then dividing by 100000
+	// This will make the fraction 5 decimal places
+	return float64(int(fraction*100000)) / 100000
 }
 
 /*
@@ -183,189 +326,259 @@ func removeDuplicates(queries []string) []string {
 }
 
 /*
-Rebuild full Gutendex result from multiple requests
+Rebuild full Gutendex result from the first page. The number of pages follows from the count and the page size of the
+first page, so the remaining pages are fetched in parallel by page number, by at most Config.GutendexConcurrency
+workers. Pages are merged in page order. The first error, or cancellation of ctx, stops all workers.
 */
-func rebuildFullGutendexResult(w http.ResponseWriter, mp shared.GutendexResult) (shared.GutendexResult, error) {
-	for mp.Next != "" {
-		// Check if URL is valid
-		_, err := url.ParseRequestURI(mp.Next)
-		if err != nil {
-			log.Println("Invalid URL:", err.Error())
-			// http.Error(w, "Invalid URL", http.StatusInternalServerError)
-			return mp, err
-		}
+func (h *Handler) rebuildFullGutendexResult(ctx context.Context, language string,
+	mp shared.GutendexResult) (shared.GutendexResult, error) {
+	if mp.Next == "" || len(mp.Results) == 0 {
+		return mp, nil
+	}
 
-		// Make request to next URL
-		res, err := client.Get(mp.Next)
-		if err != nil {
-			log.Println("Error in response:", err.Error())
-			// http.Error(w, "Error in response", http.StatusInternalServerError)
-			return mp, err
-		}
+	pageSize := len(mp.Results)
+	pageCount := (mp.Count + pageSize - 1) / pageSize
 
-		// Decode JSON
-		decoder := json.NewDecoder(res.Body)
-		var newMp shared.GutendexResult
-		err = decoder.Decode(&newMp)
-		if err != nil {
-			log.Println("Error during decoding: " + err.Error())
-			// http.Error(w, "Error during decoding", http.StatusBadRequest)
-			return mp, err
-		}
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Results of each page, indexed by page number, so the order does not depend on which worker finishes first
+	pages := make([][]shared.Book, pageCount+1)
+	jobs := make(chan int)
+	firstErr := make(chan error, 1)
+
+	workers := h.Config.GutendexConcurrency
+	if workers > pageCount-1 {
+		workers = pageCount - 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range jobs {
+				result, err := h.Gutendex.Page(workerCtx, language, page)
+				if err != nil {
+					// Only the first error is kept, the others are most likely caused by the cancellation
+					select {
+					case firstErr <- err:
+						log.Println("Error when getting page " + strconv.Itoa(page) + ": " + err.Error())
+					default:
+					}
+					cancel()
+					return
+				}
+				pages[page] = result.Results
+			}
+		}()
+	}
 
-		// Append new results to current results
-		mp.Results = append(mp.Results, newMp.Results...)
+	// Hand out the pages, stop early if a worker failed or the client went away
+feed:
+	for page := 2; page <= pageCount; page++ {
+		select {
+		case jobs <- page:
+		case <-workerCtx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
 
-		// Update next and previous fields
-		mp.Next = newMp.Next
-		mp.Previous = newMp.Previous
+	select {
+	case err := <-firstErr:
+		return mp, err
+	default:
+	}
+	if ctx.Err() != nil {
+		return mp, ctx.Err()
+	}
 
-		// log.Println("Current count: " + strconv.Itoa(len(mp.Results)))
+	// Append the pages in order
+	for _, results := range pages[2:] {
+		mp.Results = append(mp.Results, results...)
 	}
+	mp.Next = ""
 
 	return mp, nil
 }
 
 /*
-Remove empty elements from bookCounts, i.e. elements with language="", books=0, authors=0, fraction=0
+Get unique authors from a list of books. Authors are distinguished by name and birth and death year, see authorKey.
 */
-func removeEmptyElements(counts []shared.BookCount) []shared.BookCount {
-	var newCounts []shared.BookCount
-	for _, count := range counts {
-		if count.Language == "" && count.Books == 0 && count.Authors == 0 && count.Fraction == 0 {
-			continue
-		} else {
-			newCounts = append(newCounts, count)
+func getUniqueAuthors(books []shared.Book) int {
+	return len(collectAuthors(books))
+}
+
+/*
+Get the unique authors of the books, distinguished by authorKey, with the number of books by each. Authors are in the
+order they are first found.
+*/
+func collectAuthors(books []shared.Book) []shared.Author {
+	// Index of every author in authors, by key
+	indexes := make(map[string]int)
+	var authors []shared.Author
+	for _, book := range books {
+		// Loop through authors and add to map
+		// Note: Some books have no authors, this deals with that, they will not be added to the map
+		counted := make(map[string]bool)
+		for _, author := range book.Authors {
+			key := authorKey(author)
+			index, ok := indexes[key]
+			if !ok {
+				index = len(authors)
+				indexes[key] = index
+				authors = append(authors, shared.Author{
+					Name:      author.Name,
+					BirthYear: author.BirthYear,
+					DeathYear: author.DeathYear,
+				})
+			}
+
+			// An author listed twice for a book has still only written it once
+			if !counted[key] {
+				counted[key] = true
+				authors[index].Books++
+			}
 		}
 	}
-	return newCounts
+
+	return authors
 }
 
 /*
-Decode JSON and return as GutendexResult
+Get the key identifying an author.
 */
-func decodeJSON(w http.ResponseWriter, res *http.Response) shared.GutendexResult {
-	decoder := json.NewDecoder(res.Body)
-	mp := shared.GutendexResult{}
+func authorKey(author shared.Person) string {
+	// Also using birth and death year to distinguish between authors with the same name
+	// Note: Some authors have no birth or death year, so this is not a perfect solution
+	// It is possible that two authors with the same name and no birth or death year are not the same person
+	return author.Name + "|" + yearKey(author.BirthYear) + "|" + yearKey(author.DeathYear)
+}
 
-	err := decoder.Decode(&mp)
-	if err != nil {
-		log.Println("Error during decoding: " + err.Error())
-		http.Error(w, "Error during decoding", http.StatusBadRequest)
+/*
+Get a year as part of a key, empty if it is unknown.
+*/
+func yearKey(year *int) string {
+	if year == nil {
+		return ""
 	}
-
-	return mp
+	return strconv.Itoa(*year)
 }
 
+// GetAuthorsAndBooks
 /*
-Pretty print JSON and return as byte array
+Get authors and books from Gutendex API. Takes two-letter language code as parameter. Returns unique authors and book
+count, and how fresh the numbers are.
 */
-func prettyPrintJSON(w http.ResponseWriter, mp shared.GutendexResult) []byte {
-	output, err := json.MarshalIndent(mp, "", "\t")
+func (h *Handler) GetAuthorsAndBooks(ctx context.Context, twoLetterLanguageCode string) (int, int, Freshness, error) {
+	mp, freshness, err := h.getLanguageBooks(ctx, twoLetterLanguageCode)
 	if err != nil {
-		log.Println("Error during pretty printing: " + err.Error())
-		http.Error(w, "Error during pretty printing", http.StatusInternalServerError)
-		return nil
+		return 0, 0, freshness, err
 	}
 
-	return output
+	return getUniqueAuthors(mp.Results), mp.Count, freshness, nil
 }
 
 /*
-Get total book count from Gutendex API
+Get all books in a language, from the cache if possible. An expired result is returned right away, while it is
+refreshed in the background. Otherwise, the full result is fetched from Gutendex.
+Concurrent requests for the same language share a single fetch.
 */
-func getTotalBookCount(w http.ResponseWriter) int {
-	r, err1 := http.NewRequest(http.MethodGet, shared.CurrentGutendexApi, nil)
-	if err1 != nil {
-		log.Println("Error in creating request:", err1.Error())
-		http.Error(w, "Error in creating request", http.StatusInternalServerError)
-	}
+func (h *Handler) getLanguageBooks(ctx context.Context, twoLetterLanguageCode string) (shared.GutendexResult,
+	Freshness, error) {
+	return h.getCached(ctx, twoLetterLanguageCode, h.languageFetcher(twoLetterLanguageCode))
+}
 
-	r.Header.Add("content-type", "application/json")
-	res, err2 := client.Do(r)
-	if err2 != nil {
-		log.Println("Error in response:", err2.Error())
-		http.Error(w, "Error in response", http.StatusInternalServerError)
-	}
+/*
+Get the total number of books in Gutendex, from the cache if possible, the same way as the books in a language.
+*/
+func (h *Handler) getTotal(ctx context.Context) (int, Freshness, error) {
+	mp, freshness, err := h.getCached(ctx, totalKey, h.fetchTotal)
+	return mp.Count, freshness, err
+}
 
-	mp := decodeJSON(w, res)
-	bookCount := mp.Count
+/*
+Get the result under key from the cache, refreshing it in the background if it has expired, or from fetch if it is
+missing. Concurrent requests for the same key share a single fetch.
+*/
+func (h *Handler) getCached(ctx context.Context, key string,
+	fetch func(ctx context.Context) (shared.GutendexResult, error)) (shared.GutendexResult, Freshness, error) {
+	if cached, stored, ok := h.Cache.Lookup(key); ok {
+		freshness := Freshness{Stored: stored, Stale: h.Cache.Expired(stored)}
+		if freshness.Stale {
+			go h.refresh(key, fetch)
+		}
+		return cached, freshness, nil
+	}
 
-	return bookCount
+	mp, err := h.Flights.Do(ctx, key, fetch)
+	return mp, Freshness{Stored: time.Now()}, err
 }
 
 /*
-Get unique authors from Gutendex API. Authors are distinguished by name and birth and death year.
+Refresh the result under key in the background. Shares the fetch with any request for the same key.
 */
-func getUniqueAuthors(w http.ResponseWriter, output []byte) int {
-	var result shared.GutendexResult
-	err := json.Unmarshal(output, &result)
+func (h *Handler) refresh(key string, fetch func(ctx context.Context) (shared.GutendexResult, error)) {
+	_, err := h.Flights.Do(context.Background(), key, fetch)
 	if err != nil {
-		log.Println("Error during JSON decoding: " + err.Error())
-		http.Error(w, "Error during JSON decoding", http.StatusInternalServerError)
+		log.Println("Could not refresh cached " + key + ": " + err.Error())
 	}
+}
 
-	// Map to store unique authors
-	uniqueAuthors := make(map[string]bool)
-	for _, book := range result.Results {
-		// Loop through authors and add to map
-		// Note: Some books have no authors, this deals with that, they will not be added to the map
-		for _, author := range book.Authors {
-			// Also using birth and death year to distinguish between authors with the same name
-			// Note: Some authors have no birth or death year, so this is not a perfect solution
-			// It is possible that two authors with the same name and no birth or death year are not the same person
-			uniqueAuthors[author.Name+strconv.Itoa(author.BirthYear)+strconv.Itoa(author.DeathYear)] = true
-		}
+/*
+Return a function fetching all books in a language, to be run by h.Flights.
+*/
+func (h *Handler) languageFetcher(twoLetterLanguageCode string) func(ctx context.Context) (shared.GutendexResult,
+	error) {
+	return func(ctx context.Context) (shared.GutendexResult, error) {
+		return h.fetchLanguageBooks(ctx, twoLetterLanguageCode)
 	}
-
-	// Return length of map
-	return len(uniqueAuthors)
 }
 
 /*
-Make request to Gutendex API. Takes languageQuery as parameter, which is a two-letter language code. Returns response.
+Rebuild the full result for a language from Gutendex, and cache it in memory and on disk.
 */
-func makeGutendexRequest(w http.ResponseWriter, r *http.Request, languageQuery string) *http.Response {
-	// Create new request
-	r, err1 := http.NewRequest(http.MethodGet, shared.CurrentGutendexApi+"?languages="+languageQuery, nil)
-	if err1 != nil {
-		log.Println("Error in creating request:", err1.Error())
-		http.Error(w, "Error in creating request", http.StatusInternalServerError)
+func (h *Handler) fetchLanguageBooks(ctx context.Context, twoLetterLanguageCode string) (shared.GutendexResult, error) {
+	mp, err := h.Gutendex.Page(ctx, twoLetterLanguageCode, 1)
+	if err != nil {
+		return mp, err
 	}
 
-	// Setting content type -> effect depends on the service provider
-	r.Header.Add("content-type", "application/json")
+	// No more pages to fetch if there are no books
+	if mp.Count > 0 {
+		mp, err = h.rebuildFullGutendexResult(ctx, twoLetterLanguageCode, mp)
+		if err != nil {
+			return mp, err
+		}
+	}
 
-	// Issue request
-	res, err2 := client.Do(r)
-	if err2 != nil {
-		log.Println("Error in response:", err2.Error())
-		http.Error(w, "Error in response", http.StatusInternalServerError)
+	h.Cache.Set(twoLetterLanguageCode, mp)
+	if h.Store != nil {
+		if err = h.Store.Save(cache.KindBooks, twoLetterLanguageCode, mp, time.Now()); err != nil {
+			log.Println("Could not save books in " + twoLetterLanguageCode + " to disk: " + err.Error())
+		}
 	}
 
-	return res
+	return mp, nil
 }
 
-// GetAuthorsAndBooks
 /*
-Get authors and books from Gutendex API. Takes two-letter language code as parameter. Returns unique authors and book count.
-Returns -1, -1 if there's an error.
+Get the total number of books from Gutendex, and cache it in memory and on disk. Cached as a result with only a count.
 */
-func GetAuthorsAndBooks(w http.ResponseWriter, twoLetterLanguageCode string) (int, int) {
-	res := makeGutendexRequest(w, nil, twoLetterLanguageCode)
-	mp := decodeJSON(w, res)
-
-	var err error
-	mp, err = rebuildFullGutendexResult(w, mp)
+func (h *Handler) fetchTotal(ctx context.Context) (shared.GutendexResult, error) {
+	total, err := h.Gutendex.Total(ctx)
 	if err != nil {
-		log.Println("Error during rebuilding of full result: " + err.Error())
-		http.Error(w, "Error during rebuilding of full result", http.StatusInternalServerError)
-		return -1, -1
+		return shared.GutendexResult{}, err
 	}
 
-	output := prettyPrintJSON(w, mp)
-
-	uniqueAuthors := getUniqueAuthors(w, output)
+	h.Cache.Set(totalKey, shared.GutendexResult{Count: total})
+	if h.Store != nil {
+		if err = h.Store.Save(cache.KindTotal, totalKey, total, time.Now()); err != nil {
+			log.Println("Could not save total book count to disk: " + err.Error())
+		}
+	}
 
-	return uniqueAuthors, mp.Count
+	return shared.GutendexResult{Count: total}, nil
 }
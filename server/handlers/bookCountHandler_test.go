@@ -1,31 +1,36 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/upstream"
+	"prog2005assignment1/server/util"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestBookCountHandler(t *testing.T) {
-	// Testing the book count handler, with a "fake" endpoint
-	bookCountURL := "http://localhost:" + shared.DefaultPort + shared.BookCountPath + "?language=no,la,invalid"
-
-	req, err := http.NewRequest("GET", bookCountURL, nil)
-	if err != nil {
-		t.Fatal(err)
-	}
+	handler, _, _, _ := newTestHandler()
 
+	// Duplicates, also by name, are ignored, invalid and unknown languages get an error
+	req := httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=no,la,e1,Norwegian,xx", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(handleBookCountGetRequest)
 
-	handler.ServeHTTP(rr, req)
+	handler.BookCountHandler(rr, req)
 
 	// Test the status code
 	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+		t.Fatalf("handler returned wrong status code: got %v want %v, body: %v",
+			status, http.StatusOK, rr.Body.String())
 	}
 
 	// Test the content type
@@ -35,48 +40,714 @@ func TestBookCountHandler(t *testing.T) {
 			contentType, expectedContentType)
 	}
 
-	// Expecting an array of two bookCount structs
-	// The first bookCount struct should have the language code "no" and the count above 15, authorCount above 10
-	// The second bookCount struct should have the language code "la" and the count above 120, authorCount above 80
-	// This is due to the Gutendex is ever-changing
-
 	// Decode the JSON
-	decoder := json.NewDecoder(rr.Body)
-	var bookCounts []shared.BookCount
-	err = decoder.Decode(&bookCounts)
+	var results []shared.BookCountResult
+	err := json.NewDecoder(rr.Body).Decode(&results)
 	if err != nil {
-		t.Errorf("Failed to decode JSON: %v", err)
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected a result for each of the 4 languages, got: %+v", results)
+	}
+
+	// 44 books in total; the Latin books span two pages, so all authors are only found if both pages are read
+	want := []shared.BookCount{
+		{Language: "no", Input: "no", Books: 4, Authors: 2, Fraction: 0.09090},
+		{Language: "la", Input: "la", Books: testLatinBooks, Authors: 5, Fraction: 0.90909},
+	}
+	for i, bookCount := range want {
+		if results[i].Error != nil || !reflect.DeepEqual(results[i].BookCount, bookCount) {
+			t.Errorf("Unexpected result: got %+v want %+v", results[i], bookCount)
+		}
+	}
+
+	// Errors are told apart by their type, in the requested order
+	for i, kind := range map[int]util.ProblemType{2: util.InvalidParameter, 3: util.UnknownLanguage} {
+		if result := results[i]; result.Error == nil || result.Error.Type != util.ProblemTypeURI(kind) ||
+			result.Error.Parameter != "language" {
+			t.Errorf("Expected %v error for %v, got: %+v", kind.Name, result.Language, result.Error)
+		}
+	}
+}
+
+func TestBookCountHandlerNames(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	req := httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=nor,Latin,svenska,norge", nil)
+	rr := httptest.NewRecorder()
+
+	handler.BookCountHandler(rr, req)
+
+	var results []shared.BookCountResult
+	if err := json.NewDecoder(rr.Body).Decode(&results); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected a result for each of the 4 languages, got: %+v", results)
+	}
+
+	// Three letter codes, English and native names are counted by their two letter code
+	for i, want := range [][2]string{{"no", "nor"}, {"la", "Latin"}, {"sv", "svenska"}} {
+		if result := results[i]; result.Error != nil || result.Language != want[0] || result.Input != want[1] {
+			t.Errorf("Expected %v for %v, got: %+v", want[0], want[1], result)
+		}
+	}
+
+	// A near miss suggests what it may have been meant as
+	if problem := results[3].Error; problem == nil || problem.Type != util.ProblemTypeURI(util.UnknownLanguage) ||
+		!reflect.DeepEqual(problem.Suggestions, []string{"no"}) {
+		t.Errorf("Expected unknown language with suggestion, got: %+v", problem)
+	}
+}
+
+func TestBookCountHandlerBokmal(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	req := httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=nob", nil)
+	rr := httptest.NewRecorder()
+
+	handler.BookCountHandler(rr, req)
+
+	var bookCounts []shared.BookCount
+	if err := json.NewDecoder(rr.Body).Decode(&bookCounts); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	// Gutendex tags Bokmål books as Norwegian, so nob counts the Norwegian books instead of none
+	if len(bookCounts) != 1 || bookCounts[0].Language != "no" || bookCounts[0].Input != "nob" ||
+		bookCounts[0].Books != 4 {
+		t.Errorf("Expected the Norwegian books, got: %+v", bookCounts)
+	}
+}
+
+func TestBookCountHandlerEnvelope(t *testing.T) {
+	handler, gutendex, _, _ := newTestHandler()
+	gutendex.PageHook = func(ctx context.Context, language string, page int) error {
+		if language == "la" {
+			return errors.New("connection refused")
+		}
+		return nil
 	}
 
-	// Test the fields
+	req := httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=no,la,xx&envelope=true", nil)
+	rr := httptest.NewRecorder()
+
+	handler.BookCountHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v, body: %v", rr.Code, http.StatusOK,
+			rr.Body.String())
+	}
+
+	var envelope shared.BookCountEnvelope
+	if err := json.NewDecoder(rr.Body).Decode(&envelope); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	// The upstream failure of one language does not hide the book count of the others
+	if !envelope.Partial || len(envelope.Results) != 1 || envelope.Results[0].Language != "no" {
+		t.Errorf("Expected partial result with only no, got: %+v", envelope)
+	}
+	if len(envelope.Errors) != 2 || envelope.Errors[0].Language != "la" ||
+		envelope.Errors[0].Error.Type != util.ProblemTypeURI(util.UpstreamFailure) ||
+		envelope.Errors[0].Error.Upstream != shared.UpstreamGutendex ||
+		envelope.Errors[1].Error.Type != util.ProblemTypeURI(util.UnknownLanguage) {
+		t.Errorf("Unexpected errors: %+v", envelope.Errors)
+	}
+}
+
+func TestBookCountHandlerDownloads(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	req := httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=no,sv&include=downloads&top=2", nil)
+	rr := httptest.NewRecorder()
+
+	handler.BookCountHandler(rr, req)
+
+	var bookCounts []shared.BookCount
+	if err := json.NewDecoder(rr.Body).Decode(&bookCounts); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
 	if len(bookCounts) != 2 {
-		t.Errorf("Expected 2 bookCount structs, got: %v", len(bookCounts))
+		t.Fatalf("Expected 2 book counts, got: %+v", bookCounts)
 	}
 
-	// Test the first bookCount struct
-	if bookCounts[0].Language != "no" {
-		t.Errorf("Expected language code 'no', got: %v", bookCounts[0].Language)
+	// 0, 100, 300 and 500 downloads
+	want := &shared.Downloads{Total: 900, Median: 200, Mean: 225, Top: []shared.DownloadedBook{
+		{Id: 3, Title: "Et dukkehjem", Downloads: 500},
+		{Id: 1, Title: "Sult", Downloads: 300},
+	}}
+	if !reflect.DeepEqual(bookCounts[0].Downloads, want) {
+		t.Errorf("Unexpected downloads: got %+v want %+v", bookCounts[0].Downloads, want)
 	}
 
-	if bookCounts[0].Books < 15 {
-		t.Errorf("Expected count above 15, got: %v", bookCounts[0].Books)
+	// A language without books has no downloads
+	if downloads := bookCounts[1].Downloads; downloads == nil || downloads.Total != 0 || len(downloads.Top) != 0 {
+		t.Errorf("Expected no downloads, got: %+v", downloads)
 	}
 
-	if bookCounts[0].Authors < 10 {
-		t.Errorf("Expected authorCount above 10, got: %v", bookCounts[0].Authors)
+	// Downloads are left out unless included
+	rr = httptest.NewRecorder()
+	handler.BookCountHandler(rr, httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=no", nil))
+	if strings.Contains(rr.Body.String(), "downloads") {
+		t.Errorf("Expected no downloads, got: %v", rr.Body.String())
 	}
+}
+
+func Test_getDownloads(t *testing.T) {
+	books := []shared.Book{
+		{Id: 3, DownloadCount: 10},
+		{Id: 1, DownloadCount: 40},
+		{Id: 2, DownloadCount: 10},
+	}
+
+	// An odd number of books has a middle book, and ties are listed by Id
+	downloads := getDownloads(books, 5)
+	if downloads.Total != 60 || downloads.Median != 10 || downloads.Mean != 20 || len(downloads.Top) != 3 ||
+		downloads.Top[1].Id != 2 || downloads.Top[2].Id != 3 {
+		t.Errorf("Unexpected downloads: %+v", downloads)
+	}
+	if books[0].Id != 3 {
+		t.Errorf("Expected the books to be left in order, got: %+v", books)
+	}
+}
+
+func TestBookCountHandlerNoBooks(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	req := httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=sv", nil)
+	rr := httptest.NewRecorder()
+
+	handler.BookCountHandler(rr, req)
+
+	var bookCounts []shared.BookCount
+	if err := json.NewDecoder(rr.Body).Decode(&bookCounts); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	want := []shared.BookCount{{Language: "sv", Input: "sv"}}
+	if !reflect.DeepEqual(bookCounts, want) {
+		t.Errorf("Unexpected book counts: got %+v want %+v", bookCounts, want)
+	}
+}
+
+func TestBookCountHandlerCached(t *testing.T) {
+	handler, gutendex, _, _ := newTestHandler()
+
+	var pages int32
+	gutendex.PageHook = func(ctx context.Context, language string, page int) error {
+		atomic.AddInt32(&pages, 1)
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.BookCountHandler(rr, httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=la", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+	}
+
+	// The two pages of Latin books are only fetched by the first request
+	if pages != 2 {
+		t.Errorf("Expected 2 pages fetched, got: %v", pages)
+	}
+
+	// Both the Latin books and the total book count are cached
+	if status := handler.Cache.Status(); status.Hits != 2 || status.Misses != 2 {
+		t.Errorf("Expected 2 hits and 2 misses, got: %+v", status)
+	}
+}
 
-	// Test the second bookCount struct
-	if bookCounts[1].Language != "la" {
-		t.Errorf("Expected language code 'la', got: %v", bookCounts[1].Language)
+func TestBookCountHandlerStale(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	// An expired result, with a single Latin book
+	stored := time.Now().Add(-2 * time.Hour)
+	handler.Cache.SetAt("la", shared.GutendexResult{Count: 1, Results: []shared.Book{{Id: 100}}}, stored)
+
+	rr := httptest.NewRecorder()
+	handler.BookCountHandler(rr, httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=la", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// The stale result is served right away
+	var bookCounts []shared.BookCount
+	if err := json.Unmarshal(rr.Body.Bytes(), &bookCounts); err != nil {
+		t.Fatal(err)
+	}
+	if len(bookCounts) != 1 || bookCounts[0].Books != 1 || !bookCounts[0].Stale {
+		t.Errorf("Expected stale result with 1 book, got: %+v", bookCounts)
+	}
+	if age, _ := strconv.Atoi(rr.Header().Get("Age")); age < 7200 {
+		t.Errorf("Expected Age of at least 7200, got: %v", rr.Header().Get("Age"))
+	}
+	if warning := rr.Header().Get("Warning"); warning != `110 - "Response is Stale"` {
+		t.Errorf("Expected stale warning, got: %v", warning)
 	}
 
-	if bookCounts[1].Books < 120 {
-		t.Errorf("Expected count above 120, got: %v", bookCounts[1].Books)
+	// The result is refreshed in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		result, at, ok := handler.Cache.Lookup("la")
+		if ok && !handler.Cache.Expired(at) {
+			if result.Count != testLatinBooks {
+				t.Errorf("Expected %v refreshed books, got: %v", testLatinBooks, result.Count)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected result to be refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
 
-	if bookCounts[1].Authors < 80 {
-		t.Errorf("Expected authorCount above 80, got: %v", bookCounts[1].Authors)
+	rr = httptest.NewRecorder()
+	handler.BookCountHandler(rr, httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=la", nil))
+	if warning := rr.Header().Get("Warning"); warning != "" {
+		t.Errorf("Expected no warning for refreshed result, got: %v", warning)
 	}
+}
+
+func TestBookCountHandlerGutendexDown(t *testing.T) {
+	handler, gutendex, _, _ := newTestHandler()
+
+	rr := httptest.NewRecorder()
+	handler.BookCountHandler(rr, httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=la", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// The Latin books and the total expire while Gutendex is down
+	gutendex.Err = errors.New("connection refused")
+	stored := time.Now().Add(-2 * time.Hour)
+	for _, key := range []string{"la", totalKey} {
+		result, _, _ := handler.Cache.Lookup(key)
+		handler.Cache.SetAt(key, result, stored)
+	}
+
+	// The cached language is still counted, against the last known total
+	rr = httptest.NewRecorder()
+	handler.BookCountHandler(rr, httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=la", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var bookCounts []shared.BookCount
+	if err := json.Unmarshal(rr.Body.Bytes(), &bookCounts); err != nil {
+		t.Fatal(err)
+	}
+	want := fraction(testLatinBooks, len(gutendex.Library))
+	if len(bookCounts) != 1 || bookCounts[0].Books != testLatinBooks || bookCounts[0].Fraction != want ||
+		!bookCounts[0].Stale {
+		t.Errorf("Expected stale result with %v books, got: %+v", testLatinBooks, bookCounts)
+	}
+	if warning := rr.Header().Get("Warning"); warning != `110 - "Response is Stale"` {
+		t.Errorf("Expected stale warning, got: %v", warning)
+	}
+}
+
+func TestBookCountHandlerCoalesced(t *testing.T) {
+	handler, gutendex, _, _ := newTestHandler()
 
+	// Slow pages, so the requests overlap
+	var pages int32
+	gutendex.PageHook = func(ctx context.Context, language string, page int) error {
+		atomic.AddInt32(&pages, 1)
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			handler.BookCountHandler(rr, httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=la", nil))
+			if rr.Code != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The ten concurrent requests share one crawl of the two pages of Latin books
+	if pages != 2 {
+		t.Errorf("Expected 2 pages fetched, got: %v", pages)
+	}
+}
+
+func TestBookCountHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		query         string
+		gutendexErr   error
+		wantProblem   util.ProblemType
+		wantParameter string
+		wantUpstream  string
+	}{
+		{"No language", http.MethodGet, "", nil, util.InvalidParameter, "language", ""},
+		{"Only an invalid language", http.MethodGet, "?language=no1", nil, util.InvalidParameter, "language", ""},
+		{"Only unknown languages", http.MethodGet, "?language=xx", nil, util.UnknownLanguage, "language", ""},
+		{"Invalid envelope", http.MethodGet, "?language=no&envelope=maybe", nil, util.InvalidParameter, "envelope",
+			""},
+		{"Invalid group", http.MethodGet, "?language=no&group=family", nil, util.InvalidParameter, "group", ""},
+		{"Invalid include", http.MethodGet, "?language=no&include=ratings", nil, util.InvalidParameter, "include",
+			""},
+		{"Invalid top", http.MethodGet, "?language=no&include=downloads&top=-1", nil, util.InvalidParameter, "top",
+			""},
+		{"Top without downloads", http.MethodGet, "?language=no&top=5", nil, util.InvalidParameter, "top", ""},
+		{"Gutendex unavailable", http.MethodGet, "?language=no", errors.New("connection refused"),
+			util.UpstreamFailure, "", shared.UpstreamGutendex},
+		{"Gutendex too slow", http.MethodGet, "?language=no", context.DeadlineExceeded, util.UpstreamTimeout, "",
+			shared.UpstreamGutendex},
+		{"Gutendex breaker open", http.MethodGet, "?language=no",
+			&upstream.BreakerOpenError{Upstream: shared.UpstreamGutendex, RetryIn: time.Second},
+			util.UpstreamUnavailable, "", shared.UpstreamGutendex},
+		{"Unsupported method", http.MethodPost, "?language=no", nil, util.MethodNotSupported, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, gutendex, _, _ := newTestHandler()
+			gutendex.Err = tt.gutendexErr
+
+			req := httptest.NewRequest(tt.method, shared.BookCountPath+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			util.Guard(handler.BookCountHandler)(rr, req)
+
+			assertProblem(t, rr, tt.wantProblem, tt.wantParameter, tt.wantUpstream)
+		})
+	}
+}
+
+func TestBookCountHandlerAllFailed(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		failLatin   bool
+		wantStatus  int
+		wantProblem []util.ProblemType
+	}{
+		{"Unknown languages", "?language=norge,erik", false, http.StatusNotFound,
+			[]util.ProblemType{util.UnknownLanguage, util.UnknownLanguage}},
+		{"Invalid and unknown languages", "?language=no1,erik", false, http.StatusBadRequest,
+			[]util.ProblemType{util.InvalidParameter, util.UnknownLanguage}},
+		{"Upstream and unknown languages", "?language=la,erik", true, http.StatusBadGateway,
+			[]util.ProblemType{util.UpstreamFailure, util.UnknownLanguage}},
+	}
+	for _, tt := range tests {
+		for _, envelope := range []bool{false, true} {
+			t.Run(tt.name+" envelope "+strconv.FormatBool(envelope), func(t *testing.T) {
+				handler, gutendex, _, _ := newTestHandler()
+				if tt.failLatin {
+					gutendex.PageHook = func(ctx context.Context, language string, page int) error {
+						return errors.New("connection refused")
+					}
+				}
+
+				rr := httptest.NewRecorder()
+				handler.BookCountHandler(rr, httptest.NewRequest(http.MethodGet, shared.BookCountPath+tt.query+
+					"&envelope="+strconv.FormatBool(envelope), nil))
+
+				if rr.Code != tt.wantStatus {
+					t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+				}
+
+				// Every language is reported, not only the first one
+				var errs []shared.LanguageError
+				if envelope {
+					var body shared.BookCountEnvelope
+					if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+						t.Fatalf("Failed to decode JSON: %v", err)
+					}
+					if body.Partial || len(body.Results) != 0 {
+						t.Errorf("Unexpected envelope: %+v", body)
+					}
+					errs = body.Errors
+				} else if err := json.NewDecoder(rr.Body).Decode(&errs); err != nil {
+					t.Fatalf("Failed to decode JSON: %v", err)
+				}
+
+				if len(errs) != len(tt.wantProblem) {
+					t.Fatalf("Expected %v errors, got: %+v", len(tt.wantProblem), errs)
+				}
+				for i, kind := range tt.wantProblem {
+					if errs[i].Error.Type != util.ProblemTypeURI(kind) {
+						t.Errorf("Unexpected error for %v: %+v", errs[i].Language, errs[i].Error)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestBookCountHandlerLanguageAPIDown(t *testing.T) {
+	handler, _, languages, _ := newTestHandler()
+	handler.Config.LanguageCrossCheck = true
+	languages.Err = errors.New("connection refused")
+
+	rr := httptest.NewRecorder()
+	handler.BookCountHandler(rr, httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=no,xx", nil))
+
+	var results []shared.BookCountResult
+	if err := json.NewDecoder(rr.Body).Decode(&results); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	// Languages are still validated by the registry, the failed cross-check is only logged
+	if rr.Code != http.StatusOK || len(results) != 2 || results[0].Error != nil || results[0].Books != 4 ||
+		results[1].Error == nil || results[1].Error.Type != util.ProblemTypeURI(util.UnknownLanguage) {
+		t.Errorf("Unexpected response: %v %+v", rr.Code, results)
+	}
+}
+
+func Test_rebuildFullGutendexResultConcurrent(t *testing.T) {
+	handler, gutendex, _, _ := newTestHandler()
+	handler.Config.GutendexConcurrency = 3
+	gutendex.PageSize = 3
+
+	// Track the number of pages fetched at the same time
+	var inFlight, maxInFlight int32
+	gutendex.PageHook = func(ctx context.Context, language string, page int) error {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}
+
+	first, err := gutendex.Page(context.Background(), "la", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := handler.rebuildFullGutendexResult(context.Background(), "la", first)
+	if err != nil {
+		t.Fatalf("rebuildFullGutendexResult() returned error: %v", err)
+	}
+
+	if len(full.Results) != testLatinBooks {
+		t.Fatalf("Expected %v books, got: %v", testLatinBooks, len(full.Results))
+	}
+
+	// Pages are merged in page order, whichever worker finished first
+	for i, book := range full.Results {
+		if book.Id != 100+i {
+			t.Fatalf("Expected book %v at position %v, got: %v", 100+i, i, book.Id)
+		}
+	}
+
+	if max := atomic.LoadInt32(&maxInFlight); max > 3 {
+		t.Errorf("Expected at most 3 pages in flight, got: %v", max)
+	}
+}
+
+func Test_rebuildFullGutendexResultError(t *testing.T) {
+	handler, gutendex, _, _ := newTestHandler()
+	gutendex.PageSize = 3
+
+	pageErr := errors.New("page 5 failed")
+	gutendex.PageHook = func(ctx context.Context, language string, page int) error {
+		if page == 5 {
+			return pageErr
+		}
+		return ctx.Err()
+	}
+
+	first, err := gutendex.Page(context.Background(), "la", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = handler.rebuildFullGutendexResult(context.Background(), "la", first); err != pageErr {
+		t.Errorf("Expected the error of page 5, got: %v", err)
+	}
+}
+
+func Test_rebuildFullGutendexResultCancelled(t *testing.T) {
+	handler, gutendex, _, _ := newTestHandler()
+	gutendex.PageSize = 3
+
+	first, err := gutendex.Page(context.Background(), "la", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pages block until the client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	gutendex.PageHook = func(ctx context.Context, language string, page int) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if _, err = handler.rebuildFullGutendexResult(ctx, "la", first); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestBookCountHandlerDeadline(t *testing.T) {
+	handler, gutendex, _, _ := newTestHandler()
+	handler.Config.BookCountTimeout.Duration = 50 * time.Millisecond
+	gutendex.PageSize = 3
+
+	// Every page after the first waits until the request has timed out
+	release := make(chan struct{})
+	var pages int32
+	gutendex.PageHook = func(ctx context.Context, language string, page int) error {
+		atomic.AddInt32(&pages, 1)
+		if page == 1 {
+			return nil
+		}
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	mux := http.NewServeMux()
+	handler.Register(mux)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=la", nil))
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusGatewayTimeout)
+	}
+
+	// The crawl outlives the request, and caches all 14 pages
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, _, ok := handler.Cache.Lookup("la"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the crawl to be cached after the request timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The next request is answered from the cache, without crawling again
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=la", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if fetched := atomic.LoadInt32(&pages); fetched != 14 {
+		t.Errorf("Expected 14 pages fetched once, got: %v", fetched)
+	}
+}
+
+func TestBookCountHandlerClientGone(t *testing.T) {
+	handler, gutendex, _, _ := newTestHandler()
+	gutendex.PageSize = 3
+
+	// The client goes away while the second page is fetched. The first page is served right away.
+	ctx, cancel := context.WithCancel(context.Background())
+	var pages int32
+	gutendex.PageHook = func(pageCtx context.Context, language string, page int) error {
+		if page == 1 {
+			return nil
+		}
+		atomic.AddInt32(&pages, 1)
+		if page == 2 {
+			cancel()
+		}
+		<-pageCtx.Done()
+		return pageCtx.Err()
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=la", nil).WithContext(ctx)
+	handler.BookCountHandler(rr, req)
+
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected nothing written for a client that went away, got: %q", rr.Body.String())
+	}
+	if started := atomic.LoadInt32(&pages); started > int32(handler.Config.GutendexConcurrency) {
+		t.Errorf("Expected at most %v pages started, got: %v", handler.Config.GutendexConcurrency, started)
+	}
+	if _, _, ok := handler.Cache.Lookup("la"); ok {
+		t.Error("Expected cancelled crawl not to be cached")
+	}
+}
+
+func TestBookCountHandlerGroup(t *testing.T) {
+	handler, gutendex, _, _ := newTestHandler()
+	andric := shared.Person{Name: "Andrić, Ivo", BirthYear: year(1892), DeathYear: year(1975)}
+	krleza := shared.Person{Name: "Krleža, Miroslav", BirthYear: year(1893), DeathYear: year(1981)}
+	njegos := shared.Person{Name: "Petrović-Njegoš, Petar II", BirthYear: year(1813), DeathYear: year(1851)}
+	gutendex.Library = append(gutendex.Library,
+		shared.Book{Id: 5, Title: "Na Drini ćuprija", Authors: []shared.Person{andric}, Languages: []string{"sr"}},
+		shared.Book{Id: 6, Title: "Povratak Filipa Latinovicza", Authors: []shared.Person{krleza},
+			Languages: []string{"hr"}},
+		// Tagged with two languages of the group, only counted once
+		shared.Book{Id: 7, Title: "Prokleta avlija", Authors: []shared.Person{andric}, Languages: []string{"sr", "bs"}},
+		shared.Book{Id: 8, Title: "Gorski vijenac", Authors: []shared.Person{njegos}, Languages: []string{"sh"}},
+	)
+
+	var mu sync.Mutex
+	crawled := map[string]bool{}
+	gutendex.PageHook = func(ctx context.Context, language string, page int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		crawled[language] = true
+		return nil
+	}
+
+	// Any member of the group names the whole group, so sr is a duplicate of hr
+	req := httptest.NewRequest(http.MethodGet, shared.BookCountPath+"?language=hr,sr,nb,la&group=macro", nil)
+	rr := httptest.NewRecorder()
+
+	handler.BookCountHandler(rr, req)
+
+	var results []shared.BookCountResult
+	if err := json.NewDecoder(rr.Body).Decode(&results); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got: %+v", results)
+	}
+
+	// 48 books in total
+	want := shared.BookCount{
+		Language: "sh", Input: "hr", Books: 4, Authors: 3, Fraction: 0.08333,
+		Members: []shared.BookCount{
+			{Language: "sh", Books: 1, Authors: 1, Fraction: 0.02083},
+			{Language: "bs", Books: 1, Authors: 1, Fraction: 0.02083},
+			{Language: "hr", Books: 1, Authors: 1, Fraction: 0.02083},
+			{Language: "sr", Books: 2, Authors: 1, Fraction: 0.04166},
+		},
+	}
+	if !reflect.DeepEqual(results[0].BookCount, want) {
+		t.Errorf("Unexpected results: got %+v want %+v", results[0].BookCount, want)
+	}
+
+	// Bokmål and Nynorsk books are tagged no by Gutendex, so the Norwegian group is no alone
+	norwegian := shared.BookCount{
+		Language: "no", Input: "nb", Books: 4, Authors: 2, Fraction: 0.08333,
+		Members: []shared.BookCount{{Language: "no", Books: 4, Authors: 2, Fraction: 0.08333}},
+	}
+	if !reflect.DeepEqual(results[1].BookCount, norwegian) {
+		t.Errorf("Unexpected Norwegian result: got %+v want %+v", results[1].BookCount, norwegian)
+	}
+	if crawled["nb"] || crawled["nn"] {
+		t.Errorf("Expected only no to be crawled for Norwegian, got: %v", crawled)
+	}
+
+	// A language outside any macrolanguage is a group of its own
+	if la := results[2].BookCount; la.Language != "la" || la.Books != testLatinBooks || len(la.Members) != 1 {
+		t.Errorf("Unexpected Latin result: %+v", la)
+	}
 }
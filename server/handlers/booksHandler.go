@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sort keys of /books
+const (
+	booksSortId     = "id"
+	booksSortTitle  = "title"
+	booksSortAuthor = "author"
+)
+
+// Default and largest number of books on a page of /books, the default is the page size of Gutendex
+const (
+	defaultBooksLimit = 32
+	maxBooksLimit     = 1000
+)
+
+// BooksHandler
+/*
+Handle requests for /books, only GET requests are supported.
+*/
+func (h *Handler) BooksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleBooksGetRequest(w, r)
+	default:
+		util.WriteMethodNotSupported(w, r)
+		return
+	}
+}
+
+/*
+Handle GET request for /books, returning a page of the books in the requested languages that match the filters. The
+books are filtered and sorted from the crawled books of each language, the same as bookcount counts, instead of
+asking Gutendex for every query.
+*/
+func (h *Handler) handleBooksGetRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("content-type", "application/json")
+
+	// Uses ?language={:language+}, the same as bookcount
+	languageQuery := r.URL.Query().Get("language")
+	if languageQuery == "" {
+		util.WriteProblem(w, r, util.InvalidParameter, "No language specified. See documentation (README).",
+			util.Parameter("language"))
+		return
+	}
+
+	// With group=macro, the members of a macrolanguage are listed together, e.g. sh, bs, hr and sr
+	macro, ok := parseGroup(w, r)
+	if !ok {
+		return
+	}
+
+	// Every language has to be known, since a listing missing some of them would be misleading
+	var codes []string
+	resolved := map[string]bool{}
+	for _, input := range removeDuplicates(strings.Split(languageQuery, ",")) {
+		code, ok := util.ResolveLanguage(r.Context(), h.crossCheck(), input)
+		if !ok {
+			util.WriteProblemDetails(w, util.LanguageProblem(r, input, "language"))
+			return
+		}
+		for _, member := range languageGroup(code, macro) {
+			if !resolved[member] {
+				resolved[member] = true
+				codes = append(codes, member)
+			}
+		}
+	}
+
+	filter, ok := parseBookFilter(w, r)
+	if !ok {
+		return
+	}
+	page := shared.BookPage{Languages: codes}
+	after, ok := parseBooksPage(w, r, &page)
+	if !ok {
+		return
+	}
+
+	books, freshness, err := h.getBooks(r.Context(), codes)
+	if err != nil {
+		log.Println("Error during rebuilding of full result: " + err.Error())
+		util.UpstreamError(w, r, err, shared.UpstreamGutendex, "Error during rebuilding of full result",
+			http.StatusBadGateway)
+		return
+	}
+
+	matching := make([]shared.Book, 0)
+	for _, book := range books {
+		if filter.matches(book) {
+			matching = append(matching, book)
+		}
+	}
+	desc := page.Order == orderDesc
+	sort.SliceStable(matching, func(i, j int) bool {
+		return newBookCursor(matching[i], page.Sort, page.Order).before(newBookCursor(matching[j], page.Sort,
+			page.Order), desc)
+	})
+
+	// The page starts after the book of the cursor, so books added or removed before it do not shift the page
+	start := 0
+	if after != nil {
+		start = sort.Search(len(matching), func(i int) bool {
+			return after.before(newBookCursor(matching[i], page.Sort, page.Order), desc)
+		})
+	}
+	end := start + page.Limit
+	if end >= len(matching) {
+		end = len(matching)
+	} else {
+		page.Next = newBookCursor(matching[end-1], page.Sort, page.Order).encode()
+	}
+
+	page.Total = len(matching)
+	page.Books = matching[start:end]
+	page.Stale = freshness.Stale
+	setFreshnessHeaders(w, []Freshness{freshness})
+
+	marshaledPage, err := json.MarshalIndent(page, "", "\t")
+	if err != nil {
+		log.Println("Error during JSON encoding: " + err.Error())
+		util.WriteProblem(w, r, util.InternalError, "Error during JSON encoding.")
+		return
+	}
+
+	_, err = w.Write(marshaledPage)
+	if err != nil {
+		log.Println("Failed to write response: " + err.Error())
+	}
+}
+
+/*
+Get the books in any of the languages, given as two-letter codes. Books tagged with several of the languages are
+included once, by Id. Returns the freshness of the oldest data. Fails if any language fails.
+*/
+func (h *Handler) getBooks(ctx context.Context, codes []string) ([]shared.Book, Freshness, error) {
+	var books []shared.Book
+	seen := map[int]bool{}
+	freshness := Freshness{Stored: time.Now()}
+
+	for _, code := range codes {
+		mp, languageFreshness, err := h.getLanguageBooks(ctx, code)
+		if err != nil {
+			return nil, languageFreshness, err
+		}
+		if languageFreshness.Stored.Before(freshness.Stored) {
+			freshness.Stored = languageFreshness.Stored
+		}
+		freshness.Stale = freshness.Stale || languageFreshness.Stale
+
+		for _, book := range mp.Results {
+			if !seen[book.Id] {
+				seen[book.Id] = true
+				books = append(books, book)
+			}
+		}
+	}
+
+	return books, freshness, nil
+}
+
+/*
+The filters of /books. Text filters are lowercase and match any part of the field, ignoring case. Empty filters
+match every book.
+*/
+type bookFilter struct {
+	author    string
+	title     string
+	subject   string
+	bookshelf string
+	mediaType string
+	// Copyright statuses to match, "true", "false" or "null" for unknown
+	copyright map[string]bool
+}
+
+/*
+Read the author, title, subject, bookshelf, media_type and copyright parameters of the request. Writes the problem
+and returns false if a parameter is invalid.
+*/
+func parseBookFilter(w http.ResponseWriter, r *http.Request) (bookFilter, bool) {
+	query := r.URL.Query()
+	filter := bookFilter{
+		author:    strings.ToLower(query.Get("author")),
+		title:     strings.ToLower(query.Get("title")),
+		subject:   strings.ToLower(query.Get("subject")),
+		bookshelf: strings.ToLower(query.Get("bookshelf")),
+		mediaType: strings.ToLower(query.Get("media_type")),
+	}
+
+	// Uses the same values as Gutendex, e.g. copyright=false,null
+	if copyrightQuery := query.Get("copyright"); copyrightQuery != "" {
+		filter.copyright = map[string]bool{}
+		for _, status := range strings.Split(copyrightQuery, ",") {
+			if status != "true" && status != "false" && status != "null" {
+				util.WriteProblem(w, r, util.InvalidParameter, "Invalid copyright '"+status+
+					"'. Please specify true, false or null.", util.Parameter("copyright"))
+				return bookFilter{}, false
+			}
+			filter.copyright[status] = true
+		}
+	}
+
+	return filter, true
+}
+
+/*
+Report whether the book matches every filter.
+*/
+func (f bookFilter) matches(book shared.Book) bool {
+	if f.title != "" && !strings.Contains(strings.ToLower(book.Title), f.title) {
+		return false
+	}
+	if f.mediaType != "" && strings.ToLower(book.MediaType) != f.mediaType {
+		return false
+	}
+	if f.copyright != nil {
+		status := "null"
+		if book.Copyright != nil {
+			status = strconv.FormatBool(*book.Copyright)
+		}
+		if !f.copyright[status] {
+			return false
+		}
+	}
+
+	authors := make([]string, 0, len(book.Authors))
+	for _, author := range book.Authors {
+		authors = append(authors, author.Name)
+	}
+	return containsAny(authors, f.author) && containsAny(book.Subjects, f.subject) &&
+		containsAny(book.Bookshelves, f.bookshelf)
+}
+
+/*
+Report whether any of the values contains the lowercase part, ignoring case. An empty part is in any values.
+*/
+func containsAny(values []string, part string) bool {
+	if part == "" {
+		return true
+	}
+	for _, value := range values {
+		if strings.Contains(strings.ToLower(value), part) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Read the sort, order, limit and cursor parameters of the request into page. Sorting is by id, ascending, unless
+given. Returns the cursor to continue after, nil for the first page. Writes the problem and returns false if a
+parameter is invalid.
+*/
+func parseBooksPage(w http.ResponseWriter, r *http.Request, page *shared.BookPage) (*bookCursor, bool) {
+	query := r.URL.Query()
+
+	page.Sort = query.Get("sort")
+	switch page.Sort {
+	case "":
+		page.Sort = booksSortId
+	case booksSortId, booksSortTitle, booksSortAuthor:
+	default:
+		util.WriteProblem(w, r, util.InvalidParameter, "Invalid sort '"+page.Sort+"'. Please specify "+booksSortId+
+			", "+booksSortTitle+" or "+booksSortAuthor+".", util.Parameter("sort"))
+		return nil, false
+	}
+
+	page.Order = query.Get("order")
+	switch page.Order {
+	case "":
+		page.Order = orderAsc
+	case orderAsc, orderDesc:
+	default:
+		util.WriteProblem(w, r, util.InvalidParameter, "Invalid order '"+page.Order+"'. Please specify "+orderAsc+
+			" or "+orderDesc+".", util.Parameter("order"))
+		return nil, false
+	}
+
+	page.Limit = defaultBooksLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		page.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || page.Limit < 1 || page.Limit > maxBooksLimit {
+			util.WriteProblem(w, r, util.InvalidParameter, "Invalid limit specified. Please specify an integer from 1 "+
+				"to "+strconv.Itoa(maxBooksLimit)+".", util.Parameter("limit"))
+			return nil, false
+		}
+	}
+
+	cursorQuery := query.Get("cursor")
+	if cursorQuery == "" {
+		return nil, true
+	}
+	cursor, ok := decodeBookCursor(cursorQuery)
+	if !ok || cursor.Sort != page.Sort || cursor.Order != page.Order {
+		util.WriteProblem(w, r, util.InvalidParameter, "Invalid cursor. Please use the next cursor of a page with "+
+			"the same sort and order.", util.Parameter("cursor"))
+		return nil, false
+	}
+
+	return &cursor, true
+}
+
+/*
+The position of a book in a sorted listing of /books: the sort key of the book and its Id, which breaks ties. Encoded
+as the opaque cursor of the next page, along with the sort and order it is a position in.
+*/
+type bookCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Key   string `json:"k,omitempty"`
+	Id    int    `json:"i"`
+}
+
+/*
+Get the position of the book when sorted by sort, in order.
+*/
+func newBookCursor(book shared.Book, by string, order string) bookCursor {
+	cursor := bookCursor{Sort: by, Order: order, Id: book.Id}
+	switch by {
+	case booksSortTitle:
+		cursor.Key = strings.ToLower(book.Title)
+	case booksSortAuthor:
+		// Books without authors come after the others when ascending
+		cursor.Key = "1"
+		if len(book.Authors) > 0 {
+			cursor.Key = "0" + strings.ToLower(book.Authors[0].Name)
+		}
+	}
+	return cursor
+}
+
+/*
+Report whether position c comes before other, by key, then Id, reversed if desc. A position is not before itself.
+*/
+func (c bookCursor) before(other bookCursor, desc bool) bool {
+	if c.Key != other.Key {
+		return (c.Key < other.Key) != desc
+	}
+	if c.Id == other.Id {
+		return false
+	}
+	return (c.Id < other.Id) != desc
+}
+
+/*
+Encode the cursor as URL safe text.
+*/
+func (c bookCursor) encode() string {
+	// Marshalling a struct of strings and an int cannot fail
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+/*
+Decode a cursor from encode. Returns false for ok if it is not a cursor.
+*/
+func decodeBookCursor(text string) (bookCursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(text)
+	if err != nil {
+		return bookCursor{}, false
+	}
+	var cursor bookCursor
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return bookCursor{}, false
+	}
+	return cursor, true
+}
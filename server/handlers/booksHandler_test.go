@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"prog2005assignment1/server/clients"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+	"testing"
+)
+
+/*
+Get a page of books from the handler, failing the test unless it succeeds.
+*/
+func getBookPage(t *testing.T, handler *Handler, query string) shared.BookPage {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	handler.BooksHandler(rr, httptest.NewRequest(http.MethodGet, shared.BooksPath+"?"+query, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %v", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var page shared.BookPage
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return page
+}
+
+/*
+Get the ids of the books, in order.
+*/
+func bookIds(books []shared.Book) []int {
+	ids := make([]int, 0, len(books))
+	for _, book := range books {
+		ids = append(ids, book.Id)
+	}
+	return ids
+}
+
+func TestBooksHandler(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	page := getBookPage(t, handler, "language=no")
+	if page.Total != 4 || page.Limit != 32 || page.Sort != "id" || page.Order != "asc" || page.Next != "" ||
+		len(page.Languages) != 1 || page.Languages[0] != "no" {
+		t.Errorf("Unexpected page: %+v", page)
+	}
+	if ids := bookIds(page.Books); len(ids) != 4 || ids[0] != 1 || ids[3] != 4 {
+		t.Errorf("Unexpected books: %v", ids)
+	}
+	if page.Books[0].Subjects[0] != "Hunger -- Fiction" || page.Books[0].MediaType != "Text" ||
+		page.Books[0].Copyright == nil || *page.Books[0].Copyright {
+		t.Errorf("Unexpected book: %+v", page.Books[0])
+	}
+}
+
+func TestBooksHandlerFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantIds []int
+	}{
+		{"Author", "language=no&author=HAMSUN", []int{1, 2}},
+		{"Title", "language=no&title=dukke", []int{3}},
+		{"Subject", "language=no&subject=fiction", []int{1}},
+		{"Bookshelf", "language=no&bookshelf=best%20books", []int{1}},
+		{"Copyright", "language=no&copyright=null", []int{3, 4}},
+		{"Copyright list", "language=no&copyright=false,null", []int{1, 2, 3, 4}},
+		{"Media type", "language=no&media_type=text", []int{1, 2, 3}},
+		{"Combined", "language=no,la&author=hamsun&title=pan", []int{2}},
+		{"No match", "language=no&author=undset", []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, _, _, _ := newTestHandler()
+
+			page := getBookPage(t, handler, tt.query)
+			ids := bookIds(page.Books)
+			if page.Total != len(tt.wantIds) || len(ids) != len(tt.wantIds) {
+				t.Fatalf("Expected books %v, got: %v", tt.wantIds, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantIds[i] {
+					t.Errorf("Expected books %v, got: %v", tt.wantIds, ids)
+				}
+			}
+		})
+	}
+}
+
+func TestBooksHandlerSort(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	// Ignoring case, and books without authors last
+	if ids := bookIds(getBookPage(t, handler, "language=no&sort=title").Books); ids[0] != 3 || ids[3] != 1 {
+		t.Errorf("Unexpected order by title: %v", ids)
+	}
+	if ids := bookIds(getBookPage(t, handler, "language=no&sort=author").Books); ids[0] != 1 || ids[1] != 2 ||
+		ids[2] != 3 || ids[3] != 4 {
+		t.Errorf("Unexpected order by author: %v", ids)
+	}
+	if ids := bookIds(getBookPage(t, handler, "language=no&order=desc").Books); ids[0] != 4 || ids[3] != 1 {
+		t.Errorf("Unexpected order by id, descending: %v", ids)
+	}
+}
+
+func TestBooksHandlerCursor(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	// Follow the cursors through all Latin books, newest first
+	var ids []int
+	query := "language=la&order=desc&limit=15"
+	for pages := 1; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("Expected 3 pages, got more")
+		}
+		page := getBookPage(t, handler, query)
+		ids = append(ids, bookIds(page.Books)...)
+		if page.Next == "" {
+			break
+		}
+		query = "language=la&order=desc&limit=15&cursor=" + url.QueryEscape(page.Next)
+
+		// A newer book added after the first page does not shift the next pages
+		if pages == 1 {
+			var gutendex *clients.FakeGutendex
+			handler, gutendex, _, _ = newTestHandler()
+			gutendex.Library = append(gutendex.Library, shared.Book{Id: 500, Languages: []string{"la"}})
+		}
+	}
+
+	if len(ids) != testLatinBooks || ids[0] != 100+testLatinBooks-1 || ids[testLatinBooks-1] != 100 {
+		t.Errorf("Unexpected books: %v", ids)
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] != ids[i-1]-1 {
+			t.Errorf("Books out of order, missing or repeated: %v", ids)
+			break
+		}
+	}
+}
+
+func TestBooksHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		query         string
+		wantProblem   util.ProblemType
+		wantParameter string
+	}{
+		{"No language", http.MethodGet, "", util.InvalidParameter, "language"},
+		{"Unknown language", http.MethodGet, "language=no,xx", util.UnknownLanguage, "language"},
+		{"Invalid copyright", http.MethodGet, "language=no&copyright=maybe", util.InvalidParameter, "copyright"},
+		{"Invalid sort", http.MethodGet, "language=no&sort=downloads", util.InvalidParameter, "sort"},
+		{"Invalid order", http.MethodGet, "language=no&order=up", util.InvalidParameter, "order"},
+		{"Invalid limit", http.MethodGet, "language=no&limit=0", util.InvalidParameter, "limit"},
+		{"Invalid cursor", http.MethodGet, "language=no&cursor=abc", util.InvalidParameter, "cursor"},
+		{"Cursor of other sort", http.MethodGet, "language=no&sort=title&cursor=" +
+			bookCursor{Sort: booksSortId, Order: orderAsc, Id: 1}.encode(), util.InvalidParameter, "cursor"},
+		{"Unsupported method", http.MethodPost, "language=no", util.MethodNotSupported, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, _, _, _ := newTestHandler()
+
+			rr := httptest.NewRecorder()
+			util.Guard(handler.BooksHandler)(rr, httptest.NewRequest(tt.method, shared.BooksPath+"?"+tt.query, nil))
+
+			assertProblem(t, rr, tt.wantProblem, tt.wantParameter, "")
+		})
+	}
+}
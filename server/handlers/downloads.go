@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Value of the include parameter of bookcount adding download statistics
+const includeDownloads = "downloads"
+
+// Default and largest number of most downloaded books in the download statistics
+const (
+	defaultTopDownloads = 5
+	maxTopDownloads     = 100
+)
+
+/*
+Read the optional include and top parameters of the request. Returns the number of most downloaded books to list,
+or -1 if downloads are not included. Writes the problem and returns false for ok if a parameter is invalid, or if top
+is given without include=downloads, since it would have no effect.
+*/
+func parseInclude(w http.ResponseWriter, r *http.Request) (top int, ok bool) {
+	query := r.URL.Query()
+
+	top = -1
+	if includeQuery := query.Get("include"); includeQuery != "" {
+		for _, include := range strings.Split(includeQuery, ",") {
+			if include != includeDownloads {
+				util.WriteProblem(w, r, util.InvalidParameter, "Invalid include '"+include+"'. Please specify "+
+					includeDownloads+".", util.Parameter("include"))
+				return 0, false
+			}
+		}
+		top = defaultTopDownloads
+	}
+
+	if topQuery := query.Get("top"); topQuery != "" {
+		if top < 0 {
+			util.WriteProblem(w, r, util.InvalidParameter, "Invalid top specified. top is only used with include="+
+				includeDownloads+".", util.Parameter("top"))
+			return 0, false
+		}
+		var err error
+		top, err = strconv.Atoi(topQuery)
+		if err != nil || top < 0 || top > maxTopDownloads {
+			util.WriteProblem(w, r, util.InvalidParameter, "Invalid top specified. Please specify an integer from 0 to "+
+				strconv.Itoa(maxTopDownloads)+".", util.Parameter("top"))
+			return 0, false
+		}
+	}
+
+	return top, true
+}
+
+/*
+Get the total, median and mean downloads of the books, and the top most downloaded of them, most downloads first and
+ties by Id. The mean is rounded to 2 decimal places.
+*/
+func getDownloads(books []shared.Book, top int) shared.Downloads {
+	downloads := shared.Downloads{Top: make([]shared.DownloadedBook, 0, top)}
+	if len(books) == 0 {
+		return downloads
+	}
+
+	sorted := append([]shared.Book(nil), books...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].DownloadCount != sorted[j].DownloadCount {
+			return sorted[i].DownloadCount > sorted[j].DownloadCount
+		}
+		return sorted[i].Id < sorted[j].Id
+	})
+
+	for _, book := range sorted {
+		downloads.Total += book.DownloadCount
+	}
+	downloads.Mean = math.Round(float64(downloads.Total)/float64(len(sorted))*100) / 100
+
+	// The books are sorted descending, so the middle is the same either way
+	middle := len(sorted) / 2
+	downloads.Median = float64(sorted[middle].DownloadCount)
+	if len(sorted)%2 == 0 {
+		downloads.Median = float64(sorted[middle-1].DownloadCount+sorted[middle].DownloadCount) / 2
+	}
+
+	for _, book := range sorted {
+		if len(downloads.Top) == top {
+			break
+		}
+		downloads.Top = append(downloads.Top, shared.DownloadedBook{Id: book.Id, Title: book.Title,
+			Downloads: book.DownloadCount})
+	}
+
+	return downloads
+}
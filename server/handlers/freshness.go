@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Freshness struct, used to tell how old the data served from the cache is
+type Freshness struct {
+	Stored time.Time
+	Stale  bool
+}
+
+/*
+Set the Age header to the age of the oldest data in the response, and add a Warning header if any of it is stale.
+*/
+func setFreshnessHeaders(w http.ResponseWriter, freshnesses []Freshness) {
+	var age time.Duration
+	stale := false
+	for _, freshness := range freshnesses {
+		if since := time.Since(freshness.Stored); since > age {
+			age = since
+		}
+		stale = stale || freshness.Stale
+	}
+
+	w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+	if stale {
+		w.Header().Set("Warning", `110 - "Response is Stale"`)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"prog2005assignment1/server/iso639"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+	"time"
+)
+
+// Value of the group parameter merging the members of a macrolanguage, e.g. sh, bs, hr and sr
+const groupMacro = "macro"
+
+/*
+Read the optional group parameter of the request. Returns true for group=macro. Writes the problem and returns false
+for ok if the parameter is invalid.
+*/
+func parseGroup(w http.ResponseWriter, r *http.Request) (macro bool, ok bool) {
+	switch group := r.URL.Query().Get("group"); group {
+	case "":
+		return false, true
+	case groupMacro:
+		return true, true
+	default:
+		util.WriteProblem(w, r, util.InvalidParameter, "Invalid group '"+group+"'. Please specify "+groupMacro+".",
+			util.Parameter("group"))
+		return false, false
+	}
+}
+
+/*
+Get the two letter codes grouped with the language with the two letter code: the language alone, or with macro its
+macrolanguage and all members of it, e.g. sh, bs, hr and sr for any of them. The first code names the group.
+*/
+func languageGroup(code string, macro bool) []string {
+	if !macro {
+		return []string{code}
+	}
+	return iso639.Default().MacrolanguageGroup(code)
+}
+
+// GetGroupAuthorsAndBooks
+/*
+Get authors and books of a group of languages, given as two-letter codes, e.g. from languageGroup. Books tagged with
+several languages of the group are counted once, by Id, and so are authors, by the key of getUniqueAuthors. Returns
+the merged counts, the counts of each language on its own, and the freshness of the oldest data. Fails if any language
+of the group fails, since the merged counts would be wrong otherwise.
+*/
+func (h *Handler) GetGroupAuthorsAndBooks(ctx context.Context, codes []string) (int, int, []shared.BookCount,
+	Freshness, error) {
+	var books []shared.Book
+	seen := map[int]bool{}
+	members := make([]shared.BookCount, 0, len(codes))
+	freshness := Freshness{Stored: time.Now()}
+
+	for _, code := range codes {
+		mp, memberFreshness, err := h.getLanguageBooks(ctx, code)
+		if err != nil {
+			return 0, 0, nil, memberFreshness, err
+		}
+
+		members = append(members, shared.BookCount{
+			Language: code,
+			Books:    mp.Count,
+			Authors:  getUniqueAuthors(mp.Results),
+			Stale:    memberFreshness.Stale,
+		})
+		if memberFreshness.Stored.Before(freshness.Stored) {
+			freshness.Stored = memberFreshness.Stored
+		}
+		freshness.Stale = freshness.Stale || memberFreshness.Stale
+
+		for _, book := range mp.Results {
+			if !seen[book.Id] {
+				seen[book.Id] = true
+				books = append(books, book)
+			}
+		}
+	}
+
+	return getUniqueAuthors(books), len(books), members, freshness, nil
+}
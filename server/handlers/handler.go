@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"prog2005assignment1/server/cache"
+	"prog2005assignment1/server/clients"
+	"prog2005assignment1/server/config"
+	"prog2005assignment1/server/jobs"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/upstream"
+	"prog2005assignment1/server/util"
+	"time"
+)
+
+// Handler struct, holds the configuration and upstream clients used by the endpoints
+type Handler struct {
+	Config    *config.Config
+	Gutendex  clients.GutendexClient
+	Languages clients.LanguageClient
+	Countries clients.CountriesClient
+	Cache     *cache.Cache
+	Store     *cache.Store
+	Flights   *cache.Group
+	Jobs      []*jobs.Job
+	Retries   []*upstream.RetryTransport
+	Breakers  []*upstream.Breaker
+	StartTime time.Time
+}
+
+// New
+/*
+Create a handler for all endpoints, using the given upstream clients. Gutendex results are cached as configured in cfg.
+The uptime in /status is counted from now.
+*/
+func New(cfg *config.Config, gutendex clients.GutendexClient, languages clients.LanguageClient,
+	countries clients.CountriesClient) *Handler {
+	return &Handler{
+		Config:    cfg,
+		Gutendex:  gutendex,
+		Languages: languages,
+		Countries: countries,
+		Cache:     cache.New(cfg.CacheTTL.Duration, cfg.CacheMaxStale.Duration, int64(cfg.CacheMaxBytes)),
+		Flights:   cache.NewGroup(cfg.CrawlTimeout.Duration),
+		StartTime: time.Now(),
+	}
+}
+
+// Register
+/*
+Register all endpoints on mux, under the configured base path. Errors are written once per request, see util.Guard.
+*/
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc(shared.DefaultPath, h.DefaultHandler)
+	mux.HandleFunc(h.Config.StatusPath(), withTimeout(h.Config.StatusTimeout.Duration, util.Guard(h.StatusHandler)))
+	mux.HandleFunc(h.Config.ReadershipPath(), withTimeout(h.Config.ReadershipTimeout.Duration,
+		util.Guard(h.ReadershipHandler)))
+	mux.HandleFunc(h.Config.BookCountPath(), withTimeout(h.Config.BookCountTimeout.Duration,
+		util.Guard(h.BookCountHandler)))
+	mux.HandleFunc(h.Config.AuthorsPath(), withTimeout(h.Config.AuthorsTimeout.Duration,
+		util.Guard(h.AuthorsHandler)))
+	mux.HandleFunc(h.Config.BooksPath(), withTimeout(h.Config.BooksTimeout.Duration, util.Guard(h.BooksHandler)))
+	mux.HandleFunc(h.Config.SubjectsPath(), withTimeout(h.Config.SubjectsTimeout.Duration,
+		util.Guard(h.SubjectsHandler)))
+	mux.HandleFunc(h.Config.BookshelvesPath(), withTimeout(h.Config.BookshelvesTimeout.Duration,
+		util.Guard(h.BookshelvesHandler)))
+	mux.HandleFunc(h.Config.JobsPath(), util.Guard(h.JobsHandler))
+	mux.HandleFunc(h.Config.LanguagesPath(), util.Guard(h.LanguagesHandler))
+}
+
+/*
+Get the client to cross-check languages with, if configured. Languages are validated by the ISO 639 registry, the
+Language2Country API is only asked to log disagreements.
+*/
+func (h *Handler) crossCheck() clients.LanguageClient {
+	if !h.Config.LanguageCrossCheck {
+		return nil
+	}
+	return h.Languages
+}
+
+/*
+Wrap next, so the context of every request ends after timeout. All upstream calls for the request use this context,
+so a request that takes too long, or whose client goes away, stops its upstream calls right away. Crawls shared
+through h.Flights are the exception, they only stop when the clients go away, see cache.Group.
+*/
+func withTimeout(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// LoadStore
+/*
+Restore the Gutendex results and the total book count saved in Store into Cache, keeping the time they were saved.
+Returns the languages whose results have expired, to be refreshed with RefreshLanguages. Does nothing if there is no
+store.
+*/
+func (h *Handler) LoadStore() ([]string, error) {
+	if h.Store == nil {
+		return nil, nil
+	}
+
+	var stale []string
+	err := h.Store.Load(cache.KindBooks, func(key string, value json.RawMessage, stored time.Time) error {
+		var result shared.GutendexResult
+		if err := json.Unmarshal(value, &result); err != nil {
+			return err
+		}
+
+		// Results saved before the full Gutendex schema lack most of it, so they are refreshed like expired ones
+		legacy, err := upgradeLegacyResult(value, &result)
+		if err != nil {
+			return err
+		}
+
+		h.Cache.SetAt(key, result, stored)
+		if legacy || h.Cache.Expired(stored) {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return stale, err
+	}
+
+	// An expired total is refreshed by the first request counting books, like any expired result
+	err = h.Store.Load(cache.KindTotal, func(key string, value json.RawMessage, stored time.Time) error {
+		var total int
+		if err := json.Unmarshal(value, &total); err != nil {
+			return err
+		}
+
+		h.Cache.SetAt(key, shared.GutendexResult{Count: total}, stored)
+		return nil
+	})
+
+	return stale, err
+}
+
+/*
+Report whether a saved Gutendex result predates the full Gutendex schema, i.e. its books have no translators field.
+Those results have 0 for unknown birth and death years, which are cleared in result.
+*/
+func upgradeLegacyResult(value json.RawMessage, result *shared.GutendexResult) (bool, error) {
+	var probe struct {
+		Results []struct {
+			Translators json.RawMessage `json:"translators"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(value, &probe); err != nil {
+		return false, err
+	}
+	if len(probe.Results) == 0 || len(probe.Results[0].Translators) > 0 {
+		return false, nil
+	}
+
+	for _, book := range result.Results {
+		for i := range book.Authors {
+			if year := book.Authors[i].BirthYear; year != nil && *year == 0 {
+				book.Authors[i].BirthYear = nil
+			}
+			if year := book.Authors[i].DeathYear; year != nil && *year == 0 {
+				book.Authors[i].DeathYear = nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// RefreshLanguages
+/*
+Fetch all books of the languages from Gutendex again, replacing the cached results.
+*/
+func (h *Handler) RefreshLanguages(ctx context.Context, languages []string) {
+	for _, language := range languages {
+		if _, err := h.Flights.Do(ctx, language, h.languageFetcher(language)); err != nil {
+			log.Println("Could not refresh books in " + language + ": " + err.Error())
+		}
+	}
+}
+
+// WarmLanguage
+/*
+Fetch all books of the language from Gutendex again, and the countries and populations used by readership, so requests
+for the language are answered from the cache. Used by the warm-up job.
+*/
+func (h *Handler) WarmLanguage(ctx context.Context, language string) error {
+	if _, err := h.Flights.Do(ctx, language, h.languageFetcher(language)); err != nil {
+		return errors.New("could not fetch books: " + err.Error())
+	}
+
+	countries, err := h.Languages.Countries(ctx, language)
+	if err != nil {
+		return errors.New("could not get countries: " + err.Error())
+	}
+	if len(countries) == 0 {
+		return nil
+	}
+
+	codes := make([]string, len(countries))
+	for i, country := range countries {
+		codes[i] = country.Iso31661Alpha3
+	}
+	if _, err = h.Countries.Populations(ctx, codes); err != nil {
+		return errors.New("could not get populations: " + err.Error())
+	}
+
+	return nil
+}
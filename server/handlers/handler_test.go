@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"prog2005assignment1/server/cache"
+	"prog2005assignment1/server/clients"
+	"prog2005assignment1/server/config"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Number of Latin books in the test library, more than one Gutendex page
+const testLatinBooks = 40
+
+/*
+Create a handler backed by in-memory fakes. The library has 3 Norwegian books by 2 authors (and one without author),
+40 Latin books by 5 authors, and Swedish is a known language without books.
+*/
+func newTestHandler() (*Handler, *clients.FakeGutendex, *clients.FakeLanguages, *clients.FakeCountries) {
+	hamsun := shared.Person{Name: "Hamsun, Knut", BirthYear: year(1859), DeathYear: year(1952)}
+	ibsen := shared.Person{Name: "Ibsen, Henrik", BirthYear: year(1828), DeathYear: year(1906)}
+	noCopyright := false
+
+	library := []shared.Book{
+		{Id: 1, Title: "Sult", Authors: []shared.Person{hamsun}, Languages: []string{"no"},
+			Subjects: []string{"Hunger -- Fiction"}, Bookshelves: []string{"Best Books Ever Listings"},
+			Copyright: &noCopyright, MediaType: "Text", DownloadCount: 300},
+		{Id: 2, Title: "Pan", Authors: []shared.Person{hamsun}, Languages: []string{"no"}, Copyright: &noCopyright,
+			MediaType: "Text", DownloadCount: 100},
+		{Id: 3, Title: "Et dukkehjem", Authors: []shared.Person{ibsen}, Languages: []string{"no"},
+			Subjects: []string{"Marriage -- Drama"}, MediaType: "Text", DownloadCount: 500},
+		{Id: 4, Title: "Norske folkeeventyr", Authors: []shared.Person{}, Languages: []string{"no"}},
+	}
+	for i := 0; i < testLatinBooks; i++ {
+		author := shared.Person{Name: "Latin author " + strconv.Itoa(i%5)}
+		library = append(library, shared.Book{
+			Id: 100 + i, Title: "Liber " + strconv.Itoa(i), Authors: []shared.Person{author}, Languages: []string{"la"},
+		})
+	}
+
+	gutendex := &clients.FakeGutendex{Library: library}
+	languages := &clients.FakeLanguages{Languages: map[string][]shared.Country{
+		"no": {
+			{Iso31661Alpha3: "ISL", Iso31661Alpha2: "IS", OfficialName: "Iceland", Language: "no"},
+			{Iso31661Alpha3: "NOR", Iso31661Alpha2: "NO", OfficialName: "Norway", Language: "no"},
+			{Iso31661Alpha3: "SJM", Iso31661Alpha2: "SJ", OfficialName: "Svalbard and Jan Mayen Islands", Language: "no"},
+		},
+		"la": {},
+		"sv": {{Iso31661Alpha3: "SWE", Iso31661Alpha2: "SE", OfficialName: "Sweden", Language: "sv"}},
+	}}
+	countries := &clients.FakeCountries{Known: map[string]int{
+		"ISL": 366425,
+		"NOR": 5379475,
+		"SJM": 2562,
+		"SWE": 10353442,
+	}}
+
+	return New(config.Default(), gutendex, languages, countries), gutendex, languages, countries
+}
+
+/*
+Check that rr holds exactly one problem of the kind, naming the offending parameter and the failed upstream, if any.
+*/
+func assertProblem(t *testing.T, rr *httptest.ResponseRecorder, kind util.ProblemType, parameter string,
+	upstream string) {
+	t.Helper()
+
+	if rr.Code != kind.Status {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, kind.Status)
+	}
+	if contentType := rr.Header().Get("content-type"); contentType != "application/problem+json" {
+		t.Errorf("handler returned wrong content type: got %v", contentType)
+	}
+
+	var problem shared.Problem
+	decoder := json.NewDecoder(rr.Body)
+	if err := decoder.Decode(&problem); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	if decoder.More() {
+		t.Errorf("Expected a single problem, got more output: %q", rr.Body.String())
+	}
+
+	if problem.Type != util.ProblemTypeURI(kind) || problem.Title != kind.Title ||
+		problem.Status != kind.Status || problem.Detail == "" || problem.Instance == "" {
+		t.Errorf("Unexpected problem: %+v", problem)
+	}
+	if problem.Parameter != parameter {
+		t.Errorf("Expected parameter %q, got: %q", parameter, problem.Parameter)
+	}
+	if problem.Upstream != upstream {
+		t.Errorf("Expected upstream %q, got: %q", upstream, problem.Upstream)
+	}
+}
+
+/*
+Return a pointer to the population, for comparing with shared.Readership.
+*/
+func population(p int) *int {
+	return &p
+}
+
+func TestLoadStore(t *testing.T) {
+	store, err := cache.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A handler fetching Latin books and the total book count saves them to disk
+	handler, _, _, _ := newTestHandler()
+	handler.Store = store
+	if _, _, _, err = handler.GetAuthorsAndBooks(context.Background(), "la"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = handler.getTotal(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Save(cache.KindBooks, "no", shared.GutendexResult{Count: 1}, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart, the Latin books are served from the cache without Gutendex
+	restarted, gutendex, _, _ := newTestHandler()
+	restarted.Store = store
+	gutendex.Err = errors.New("connection refused")
+
+	stale, err := restarted.LoadStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0] != "no" {
+		t.Errorf("Expected no to be stale, got: %v", stale)
+	}
+
+	authors, books, _, err := restarted.GetAuthorsAndBooks(context.Background(), "la")
+	if err != nil || books != testLatinBooks || authors != 5 {
+		t.Errorf("Expected Latin books from disk, got: %v, %v, %v", authors, books, err)
+	}
+	if total, _, err := restarted.getTotal(context.Background()); err != nil || total != 44 {
+		t.Errorf("Expected total book count from disk, got: %v, %v", total, err)
+	}
+
+	// Refreshing the stale language replaces it with the books from Gutendex
+	gutendex.Err = nil
+	restarted.RefreshLanguages(context.Background(), stale)
+	if _, books, _, _ = restarted.GetAuthorsAndBooks(context.Background(), "no"); books != 4 {
+		t.Errorf("Expected 4 refreshed Norwegian books, got: %v", books)
+	}
+}
+
+func TestLoadStoreLegacy(t *testing.T) {
+	store, err := cache.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Saved before the full Gutendex schema, when unknown years were 0
+	legacy := map[string]interface{}{"count": 1, "results": []map[string]interface{}{{
+		"id": 1, "title": "Sult", "languages": []string{"no"},
+		"authors": []map[string]interface{}{{"name": "Hamsun, Knut", "birth_year": 1859, "death_year": 0}},
+	}}}
+	if err = store.Save(cache.KindBooks, "no", legacy, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, gutendex, _, _ := newTestHandler()
+	handler.Store = store
+	gutendex.Err = errors.New("connection refused")
+
+	stale, err := handler.LoadStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0] != "no" {
+		t.Errorf("Expected the legacy result to be refreshed, got: %v", stale)
+	}
+
+	result, _, _ := handler.Cache.Lookup("no")
+	if author := result.Results[0].Authors[0]; *author.BirthYear != 1859 || author.DeathYear != nil {
+		t.Errorf("Expected an unknown death year, got: %+v", author)
+	}
+}
+
+/*
+Return a pointer to the year, for shared.Person.
+*/
+func year(y int) *int {
+	return &y
+}
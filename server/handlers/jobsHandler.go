@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+)
+
+// JobsHandler
+/*
+Handle requests for /jobs, only GET requests are supported.
+*/
+func (h *Handler) JobsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleJobsGetRequest(w, r)
+	default:
+		util.WriteMethodNotSupported(w, r)
+		return
+	}
+}
+
+/*
+Handle GET request for /jobs, returning the status of every background job.
+*/
+func (h *Handler) handleJobsGetRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("content-type", "application/json")
+
+	statuses := make([]shared.JobStatus, 0, len(h.Jobs))
+	for _, job := range h.Jobs {
+		statuses = append(statuses, job.Status())
+	}
+
+	marshaledStatuses, err := json.MarshalIndent(statuses, "", "\t")
+	if err != nil {
+		log.Println("Error during JSON encoding: " + err.Error())
+		util.WriteProblem(w, r, util.InternalError, "Error during JSON encoding.")
+		return
+	}
+
+	_, err = w.Write(marshaledStatuses)
+	if err != nil {
+		log.Println("Failed to write response: " + err.Error())
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"prog2005assignment1/server/jobs"
+	"prog2005assignment1/server/shared"
+	"testing"
+	"time"
+)
+
+func TestJobsHandler(t *testing.T) {
+	handler, gutendex, _, countries := newTestHandler()
+	warmup := jobs.New("warmup", []string{"no", "la", "sv"}, time.Hour, 0, 2, handler.WarmLanguage)
+	handler.Jobs = append(handler.Jobs, warmup)
+	gutendex.PageHook = func(ctx context.Context, language string, page int) error {
+		if language == "la" {
+			return errors.New("gutendex is down")
+		}
+		return nil
+	}
+
+	warmup.RunOnce(context.Background())
+
+	// The books are cached, and the populations were looked up in one batch per language with countries
+	if _, _, ok := handler.Cache.Lookup("no"); !ok {
+		t.Error("Expected Norwegian books to be cached")
+	}
+	if countries.BatchCalls != 2 {
+		t.Errorf("Expected 2 batch lookups of populations, got: %v", countries.BatchCalls)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.JobsHandler(rr, httptest.NewRequest(http.MethodGet, shared.JobsPath, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var statuses []shared.JobStatus
+	if err := json.NewDecoder(rr.Body).Decode(&statuses); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "warmup" || statuses[0].Runs != 1 {
+		t.Fatalf("Unexpected job statuses: %+v", statuses)
+	}
+
+	failures := statuses[0].Failures
+	if len(failures) != 1 || failures[0].Language != "la" {
+		t.Errorf("Expected a failure for la, got: %+v", failures)
+	}
+}
+
+func TestJobsHandlerMethod(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	rr := httptest.NewRecorder()
+	handler.JobsHandler(rr, httptest.NewRequest(http.MethodPost, shared.JobsPath, nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotImplemented)
+	}
+}
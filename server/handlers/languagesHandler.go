@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"prog2005assignment1/server/iso639"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+	"strconv"
+	"strings"
+)
+
+// LanguagesHandler
+/*
+Handle requests for /languages, only GET requests are supported.
+*/
+func (h *Handler) LanguagesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleLanguagesGetRequest(w, r)
+	default:
+		util.WriteMethodNotSupported(w, r)
+		return
+	}
+}
+
+/*
+Handle GET request for /languages, returning the languages of the ISO 639 registry. /languages/{code} returns the
+single language with an ISO 639-1, 639-2 or 639-3 code, /languages/ the languages matching the optional part, scope
+and limit parameters.
+*/
+func (h *Handler) handleLanguagesGetRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("content-type", "application/json")
+
+	registry := iso639.Default()
+
+	var body interface{}
+	code := strings.Split(strings.TrimPrefix(r.URL.Path, h.Config.LanguagesPath()), "/")[0]
+	if code != "" {
+		language, ok := registry.Lookup(code)
+		if !ok {
+			util.WriteProblem(w, r, util.UnknownLanguage, "Unknown language code '"+code+"'.",
+				util.Parameter("code"))
+			return
+		}
+		body = language
+	} else {
+		languages, ok := h.filterLanguages(w, r, registry.Languages())
+		if !ok {
+			return
+		}
+		body = languages
+	}
+
+	marshaledLanguages, err := json.MarshalIndent(body, "", "\t")
+	if err != nil {
+		log.Println("Error during JSON encoding: " + err.Error())
+		util.WriteProblem(w, r, util.InternalError, "Error during JSON encoding.")
+		return
+	}
+
+	_, err = w.Write(marshaledLanguages)
+	if err != nil {
+		log.Println("Failed to write response: " + err.Error())
+	}
+}
+
+/*
+Keep the languages matching the part, scope and limit parameters of the request. Writes the problem and returns false
+if a parameter is invalid.
+*/
+func (h *Handler) filterLanguages(w http.ResponseWriter, r *http.Request,
+	languages []shared.Language) ([]shared.Language, bool) {
+	query := r.URL.Query()
+
+	// Which part of ISO 639 the languages need a code in
+	part := query.Get("part")
+	if part != "" && part != "1" && part != "2" && part != "3" {
+		util.WriteProblem(w, r, util.InvalidParameter, "Invalid part '"+part+"'. Please specify 1, 2 or 3.",
+			util.Parameter("part"))
+		return nil, false
+	}
+
+	scope := query.Get("scope")
+	switch scope {
+	case "", iso639.ScopeIndividual, iso639.ScopeMacrolanguage, iso639.ScopeSpecial, iso639.ScopeCollective:
+	default:
+		util.WriteProblem(w, r, util.InvalidParameter, "Invalid scope '"+scope+"'. Please specify "+
+			iso639.ScopeIndividual+", "+iso639.ScopeMacrolanguage+", "+iso639.ScopeSpecial+" or "+
+			iso639.ScopeCollective+".", util.Parameter("scope"))
+		return nil, false
+	}
+
+	limit := 0
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			util.WriteProblem(w, r, util.InvalidParameter, "Invalid limit specified. Please specify a positive integer.",
+				util.Parameter("limit"))
+			return nil, false
+		}
+	}
+
+	filtered := make([]shared.Language, 0)
+	for _, language := range languages {
+		if limit > 0 && len(filtered) == limit {
+			break
+		}
+		if scope != "" && language.Scope != scope {
+			continue
+		}
+		if (part == "1" && language.Part1 == "") || (part == "2" && language.Part2T == "") ||
+			(part == "3" && language.Part3 == "") {
+			continue
+		}
+		filtered = append(filtered, language)
+	}
+
+	return filtered, true
+}
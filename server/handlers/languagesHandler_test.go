@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"prog2005assignment1/server/iso639"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+	"testing"
+)
+
+func TestLanguagesHandler(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	rr := httptest.NewRecorder()
+	handler.LanguagesHandler(rr, httptest.NewRequest(http.MethodGet, shared.LanguagesPath+"?part=1&scope=macrolanguage",
+		nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var languages []shared.Language
+	if err := json.NewDecoder(rr.Body).Decode(&languages); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	// Only macrolanguages with a two letter code, e.g. Norwegian but not Bokmål
+	found := false
+	for _, language := range languages {
+		if language.Part1 == "" || language.Scope != iso639.ScopeMacrolanguage {
+			t.Errorf("Unexpected language: %+v", language)
+		}
+		found = found || language.Code == "no"
+	}
+	if !found {
+		t.Errorf("Expected Norwegian among %v languages", len(languages))
+	}
+}
+
+func TestLanguagesHandlerLimit(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	rr := httptest.NewRecorder()
+	handler.LanguagesHandler(rr, httptest.NewRequest(http.MethodGet, shared.LanguagesPath+"?limit=3", nil))
+
+	var languages []shared.Language
+	if err := json.NewDecoder(rr.Body).Decode(&languages); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(languages) != 3 {
+		t.Errorf("Expected 3 languages, got: %v", len(languages))
+	}
+}
+
+func TestLanguagesHandlerCode(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	// Any code of the language finds it
+	for _, code := range []string{"nb", "nob"} {
+		rr := httptest.NewRecorder()
+		handler.LanguagesHandler(rr, httptest.NewRequest(http.MethodGet, shared.LanguagesPath+code, nil))
+
+		var language shared.Language
+		if err := json.NewDecoder(rr.Body).Decode(&language); err != nil {
+			t.Fatalf("Failed to decode JSON: %v", err)
+		}
+		if language.Code != "nb" || language.Part3 != "nob" || language.Macrolanguage != "nor" ||
+			language.NativeName != "Norsk bokmål" {
+			t.Errorf("Unexpected language for %v: %+v", code, language)
+		}
+	}
+}
+
+func TestLanguagesHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		wantProblem   util.ProblemType
+		wantParameter string
+	}{
+		{"Unknown code", http.MethodGet, "xx", util.UnknownLanguage, "code"},
+		{"Invalid part", http.MethodGet, "?part=4", util.InvalidParameter, "part"},
+		{"Invalid scope", http.MethodGet, "?scope=dialect", util.InvalidParameter, "scope"},
+		{"Invalid limit", http.MethodGet, "?limit=0", util.InvalidParameter, "limit"},
+		{"Unsupported method", http.MethodPut, "", util.MethodNotSupported, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, _, _, _ := newTestHandler()
+
+			rr := httptest.NewRecorder()
+			util.Guard(handler.LanguagesHandler)(rr, httptest.NewRequest(tt.method, shared.LanguagesPath+tt.path, nil))
+
+			assertProblem(t, rr, tt.wantProblem, tt.wantParameter, "")
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -8,19 +9,20 @@ import (
 	"prog2005assignment1/server/util"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // ReadershipHandler
 /*
 Handle requests for /readership, only GET requests are supported.
 */
-func ReadershipHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ReadershipHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		handleReadershipGetRequest(w, r)
+		h.handleReadershipGetRequest(w, r)
 	default:
-		http.Error(w, "REST Method '"+r.Method+"' not supported. Currently only '"+http.MethodGet+
-			" is supported.", http.StatusNotImplemented)
+		util.WriteMethodNotSupported(w, r)
 		return
 	}
 }
@@ -28,82 +30,106 @@ func ReadershipHandler(w http.ResponseWriter, r *http.Request) {
 /*
 Handle GET request for /readership
 */
-func handleReadershipGetRequest(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleReadershipGetRequest(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("content-type", "application/json")
 
 	// Get two_letter_language_code from request, cut off .../readership/
-	cutQuery := strings.TrimPrefix(r.URL.Path, shared.ReadershipPath)
+	cutQuery := strings.TrimPrefix(r.URL.Path, h.Config.ReadershipPath())
 
 	// cutQuery should now be {two_letter_language_code}/... OR {two_letter_language_code}...
 	// This approach also handles repeating slashes, e.g. /readership/no/no/en/en
 	// Split by / and take first part
-	twoLetterLanguageCode := strings.Split(cutQuery, "/")[0]
+	languageInput := strings.Split(cutQuery, "/")[0]
 
-	if !util.LanguageCodeChecker(twoLetterLanguageCode, w) {
-		http.Error(w, "Invalid language code. Please specify a valid two letter language code.", http.StatusBadRequest)
+	// The language may also be given as a three letter code or a name, e.g. "nor" or "Norwegian"
+	twoLetterLanguageCode, ok := util.ResolveLanguage(r.Context(), h.crossCheck(), languageInput)
+	if !ok {
+		util.WriteProblemDetails(w, util.LanguageProblem(r, languageInput, "two_letter_language_code"))
 		return
 	}
 
+	// With group=macro, the members of a macrolanguage are counted together, e.g. sh, bs, hr and sr
+	macro, ok := parseGroup(w, r)
+	if !ok {
+		return
+	}
+	group := languageGroup(twoLetterLanguageCode, macro)
+
 	// Get limit from request, if not set, limit is 0. Has to be a positive integer.
 	var limit int
+	var err error
 	limitStr := r.URL.Query().Get("limit")
 	if limitStr == "" {
 		limit = 0
 	} else {
-		err := error(nil)
 		limit, err = strconv.Atoi(limitStr)
 		if err != nil || limit < 1 {
 			log.Println("Invalid limit specified.")
-			http.Error(w, "Invalid limit specified. Please specify a positive integer.", http.StatusBadRequest)
+			util.WriteProblem(w, r, util.InvalidParameter, "Invalid limit specified. Please specify a positive integer.",
+				util.Parameter("limit"))
 			return
 		}
 	}
 
 	// Get authors and books from bookCountHandler
-	authors, books := GetAuthorsAndBooks(w, twoLetterLanguageCode)
-	if authors == -1 && books == -1 {
-		// Error message already sent
+	var members []shared.BookCount
+	var authors, books int
+	var freshness Freshness
+	if macro {
+		authors, books, members, freshness, err = h.GetGroupAuthorsAndBooks(r.Context(), group)
+		twoLetterLanguageCode = group[0]
+	} else {
+		authors, books, freshness, err = h.GetAuthorsAndBooks(r.Context(), twoLetterLanguageCode)
+	}
+	if err != nil {
+		log.Println("Error during rebuilding of full result: " + err.Error())
+		util.UpstreamError(w, r, err, shared.UpstreamGutendex, "Error during rebuilding of full result",
+			http.StatusBadGateway)
 		return
 	}
 
-	// Get countries with language with two letter language code
-	countries := getCountriesWithLanguageWithTwoLetterLanguageCode(w, twoLetterLanguageCode)
-	if countries == nil {
-		log.Println("Error when trying to get countries with language.")
-		// Error message already sent
+	// Get countries with any language of the group
+	countries, err := h.getGroupCountries(r.Context(), group)
+	if err != nil {
+		log.Println("Error when trying to get countries with language: " + err.Error())
+		util.UpstreamError(w, r, err, shared.UpstreamLanguages, "Error when trying to get countries with language",
+			http.StatusServiceUnavailable)
 		return
 	} else if len(countries) == 0 {
 		log.Println("No countries found with language: " + twoLetterLanguageCode)
-		http.Error(w, "No countries found with language.", http.StatusNotFound)
+		util.WriteProblem(w, r, util.NotFound, "No countries found with language.",
+			util.Parameter("two_letter_language_code"))
 		return
 	}
 
-	// Loop through countries and get readership (inhabitants) from API
-	var readerships []shared.Readership
-	for i, country := range countries {
-		// If limit is set and reached, break
-		if limit > 0 && i >= limit {
-			break
-		}
+	// If limit is set, only look up the first countries
+	if limit > 0 && limit < len(countries) {
+		countries = countries[:limit]
+	}
 
-		// Create new readership struct
-		newReadership := shared.Readership{
-			Country:    country.OfficialName,
-			Isocode:    country.Iso31661Alpha2,
-			Books:      books,
-			Authors:    authors,
-			Readership: getReadership(w, country),
-		}
+	// Get readership (inhabitants) of every country from API, failures are reported per country
+	readerships, failures, err := h.getReaderships(r.Context(), countries, books, authors)
+	if failures == len(readerships) {
+		log.Println("Error when trying to get readership for every country with language: " + twoLetterLanguageCode)
+		util.UpstreamError(w, r, err, shared.UpstreamRestCountries, "Error when trying to get readership",
+			http.StatusBadGateway)
+		return
+	}
 
-		// Append to readerships
-		readerships = append(readerships, newReadership)
+	// Echo the language as requested, and mark the response if the book and author counts are stale
+	for i := range readerships {
+		readerships[i].Language = twoLetterLanguageCode
+		readerships[i].Input = languageInput
+		readerships[i].Stale = freshness.Stale
+		readerships[i].Members = members
 	}
+	setFreshnessHeaders(w, []Freshness{freshness})
 
 	// Return JSON
 	marshaledReaderships, err := json.MarshalIndent(readerships, "", "\t")
 	if err != nil {
 		log.Println("Error during JSON encoding: " + err.Error())
-		http.Error(w, "Error during JSON encoding.", http.StatusInternalServerError)
+		util.WriteProblem(w, r, util.InternalError, "Error during JSON encoding.")
 		return
 	}
 
@@ -111,58 +137,117 @@ func handleReadershipGetRequest(w http.ResponseWriter, r *http.Request) {
 	_, err = w.Write(marshaledReaderships)
 	if err != nil {
 		log.Println("Failed to write response: " + err.Error())
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
-		return // Not necessary, but for clarity
 	}
 }
 
 /*
-Get population of a country from RestCountries API
+Get the countries with any of the languages, each country once, in the order they are first found.
 */
-func getReadership(w http.ResponseWriter, country shared.Country) int {
-	defer client.CloseIdleConnections()
+func (h *Handler) getGroupCountries(ctx context.Context, codes []string) ([]shared.Country, error) {
+	var countries []shared.Country
+	seen := map[string]bool{}
+	for _, code := range codes {
+		languageCountries, err := h.Languages.Countries(ctx, code)
+		if err != nil {
+			return nil, err
+		}
+		for _, country := range languageCountries {
+			if !seen[country.Iso31661Alpha3] {
+				seen[country.Iso31661Alpha3] = true
+				countries = append(countries, country)
+			}
+		}
+	}
 
-	// Get response from RestCountries API
-	response, err := client.Get(shared.CurrentRestCountriesApi + "/alpha/" + country.Iso31661Alpha3)
-	if err != nil {
-		log.Println("Error when trying to get readership: " + err.Error())
-		http.Error(w, "Error when trying to get readership", http.StatusInternalServerError)
+	return countries, nil
+}
+
+/*
+Get the readership of every country. The populations are first looked up in batches, then every country missing from
+the batch result, or every country if the batch lookup failed, is looked up on its own. Returns the readerships in the
+order of countries, the number of failed lookups and the error of one of them.
+*/
+func (h *Handler) getReaderships(ctx context.Context, countries []shared.Country, books int,
+	authors int) ([]shared.Readership, int, error) {
+	readerships := make([]shared.Readership, len(countries))
+	codes := make([]string, len(countries))
+	for i, country := range countries {
+		readerships[i] = shared.Readership{
+			Country: country.OfficialName,
+			Isocode: country.Iso31661Alpha2,
+			Books:   books,
+			Authors: authors,
+		}
+		codes[i] = country.Iso31661Alpha3
 	}
 
-	// Decode JSON, could return multiple countries, but since we use alpha3 code, in reality we only get one
-	var countries []shared.CountryFromRestCountries
-	err = json.NewDecoder(response.Body).Decode(&countries)
+	populations, err := h.Countries.Populations(ctx, codes)
 	if err != nil {
-		log.Println("Error when decoding JSON: " + err.Error())
-		http.Error(w, "Error when decoding JSON", http.StatusInternalServerError)
+		log.Println("Batch lookup of populations failed, looking up each country: " + err.Error())
+		populations = map[string]int{}
 	}
 
-	// Assume we only get one country since alpha3 codes are unique, return population of first country
-	return countries[0].Population
+	var missing []int
+	for i, code := range codes {
+		if population, ok := populations[code]; ok {
+			readerships[i].Readership = &population
+		} else {
+			missing = append(missing, i)
+		}
+	}
+
+	failures, err := h.lookupReaderships(ctx, readerships, countries, missing)
+	return readerships, failures, err
 }
 
 /*
-Get all countries that uses a given language by two letter language code
+Look up the readership of the countries at the indexes in parallel, with at most Config.CountriesConcurrency lookups
+at a time. A failed lookup gives a readership of null and an error message for that country, instead of failing the
+whole request. Returns the number of failed lookups and the error of one of them.
 */
-func getCountriesWithLanguageWithTwoLetterLanguageCode(w http.ResponseWriter, code string) []shared.Country {
-	defer client.CloseIdleConnections()
-
-	// Get response from Language2Countries API
-	response, err := client.Get(shared.LanguageApi + code)
-	if err != nil {
-		log.Println("Error when trying to get countries with language: " + err.Error())
-		http.Error(w, "Error when trying to get countries with language", http.StatusServiceUnavailable)
-		return nil
-	}
+func (h *Handler) lookupReaderships(ctx context.Context, readerships []shared.Readership, countries []shared.Country,
+	indexes []int) (int, error) {
+	var failures int32
+	var errMu sync.Mutex
+	var lastErr error
+
+	// Buffered channel used as semaphore, limiting the number of lookups in flight
+	semaphore := make(chan struct{}, h.Config.CountriesConcurrency)
+	var wg sync.WaitGroup
+
+	for _, i := range indexes {
+		// Stop starting lookups once the request is cancelled, the remaining countries fail right away
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			readerships[i].Error = "Could not get population of " + countries[i].Iso31661Alpha3
+			atomic.AddInt32(&failures, 1)
+			errMu.Lock()
+			lastErr = ctx.Err()
+			errMu.Unlock()
+			continue
+		}
 
-	// Decode JSON
-	var countries []shared.Country
-	err = json.NewDecoder(response.Body).Decode(&countries)
-	if err != nil {
-		log.Println("Error when decoding JSON: " + err.Error())
-		http.Error(w, "Error when decoding JSON", http.StatusInternalServerError)
-		return nil
+		wg.Add(1)
+		go func(i int, country shared.Country) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			population, err := h.Countries.Population(ctx, country.Iso31661Alpha3)
+			if err != nil {
+				log.Println("Error when trying to get readership of " + country.Iso31661Alpha3 + ": " + err.Error())
+				readerships[i].Error = "Could not get population of " + country.Iso31661Alpha3
+				atomic.AddInt32(&failures, 1)
+				errMu.Lock()
+				lastErr = err
+				errMu.Unlock()
+				return
+			}
+
+			readerships[i].Readership = &population
+		}(i, countries[i])
 	}
 
-	return countries
+	wg.Wait()
+	return int(failures), lastErr
 }
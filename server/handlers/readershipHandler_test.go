@@ -1,118 +1,271 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/upstream"
+	"prog2005assignment1/server/util"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
-func Test_getCountriesWithLanguageWithTwoLetterLanguageCode(t *testing.T) {
-	type args struct {
-		w    http.ResponseWriter
-		code string
-	}
-	tests := []struct {
-		name string
-		args args
-		want []shared.Country
-	}{
-		{name: "Valid language code", args: args{nil, "mh"}, want: []shared.Country{{Iso31661Alpha3: "MHL", Iso31661Alpha2: "MH", OfficialName: "Marshall Islands", RegionName: "Oceania", SubRegionName: "Micronesia", Language: "mh"}}},
+func Test_handleReadershipGetRequest(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	req := httptest.NewRequest(http.MethodGet, shared.ReadershipPath+"no", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ReadershipHandler(rr, req)
+
+	// Test the status code
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v, body: %v",
+			status, http.StatusOK, rr.Body.String())
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := getCountriesWithLanguageWithTwoLetterLanguageCode(tt.args.w, tt.args.code); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("getCountriesWithLanguageWithTwoLetterLanguageCode() = %v, want %v", got, tt.want)
-			}
-		})
+
+	// Test the content type
+	expectedContentType := "application/json"
+	if contentType := rr.Header().Get("content-type"); contentType != expectedContentType {
+		t.Errorf("handler returned unexpected content type: got %v want %v",
+			contentType, expectedContentType)
 	}
-}
 
-func Test_getReadership(t *testing.T) {
-	type args struct {
-		w       http.ResponseWriter
-		country shared.Country
+	// Decode the JSON
+	var readerships []shared.Readership
+	err := json.NewDecoder(rr.Body).Decode(&readerships)
+	if err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
 	}
-	tests := []struct {
-		name        string
-		args        args
-		wantAtleast int
-	}{
-		{name: "Valid country", args: args{nil, shared.Country{Iso31661Alpha3: "MHL", Iso31661Alpha2: "MH", OfficialName: "Marshall Islands", RegionName: "Oceania", SubRegionName: "Micronesia", Language: "mh"}}, wantAtleast: 40000},
+
+	want := []shared.Readership{
+		{Country: "Iceland", Isocode: "IS", Language: "no", Input: "no", Books: 4, Authors: 2, Readership: population(366425)},
+		{Country: "Norway", Isocode: "NO", Language: "no", Input: "no", Books: 4, Authors: 2, Readership: population(5379475)},
+		{Country: "Svalbard and Jan Mayen Islands", Isocode: "SJ", Language: "no", Input: "no", Books: 4, Authors: 2, Readership: population(2562)},
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := getReadership(tt.args.w, tt.args.country); got < tt.wantAtleast {
-				t.Errorf("getReadership() = %v, want atleast %v", got, tt.wantAtleast)
-			}
-		})
+	if !reflect.DeepEqual(readerships, want) {
+		t.Errorf("Unexpected readerships: got %+v want %+v", readerships, want)
 	}
 }
 
-func Test_handleReadershipGetRequest(t *testing.T) {
-	readershipURL := "http://localhost:" + shared.DefaultPort + shared.ReadershipPath + "no"
+func Test_handleReadershipGetRequestLimit(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
 
-	req, err := http.NewRequest("GET", readershipURL, nil)
-	if err != nil {
-		t.Fatal(err)
+	req := httptest.NewRequest(http.MethodGet, shared.ReadershipPath+"no/?limit=2", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ReadershipHandler(rr, req)
+
+	var readerships []shared.Readership
+	if err := json.NewDecoder(rr.Body).Decode(&readerships); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
 	}
 
+	if len(readerships) != 2 || readerships[1].Country != "Norway" {
+		t.Errorf("Expected the first 2 countries, got: %+v", readerships)
+	}
+}
+
+func Test_handleReadershipGetRequestPartialFailure(t *testing.T) {
+	handler, _, _, countries := newTestHandler()
+	delete(countries.Known, "NOR")
+
+	req := httptest.NewRequest(http.MethodGet, shared.ReadershipPath+"no", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(handleReadershipGetRequest)
 
-	handler.ServeHTTP(rr, req)
+	handler.ReadershipHandler(rr, req)
 
-	// Test the status code
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
 	}
 
-	// Test the content type
-	expectedContentType := "application/json"
-	if contentType := rr.Header().Get("content-type"); contentType != expectedContentType {
-		t.Errorf("handler returned unexpected content type: got %v want %v",
-			contentType, expectedContentType)
+	var readerships []shared.Readership
+	if err := json.NewDecoder(rr.Body).Decode(&readerships); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	// The failed country keeps its place, with a null readership and an error
+	want := []shared.Readership{
+		{Country: "Iceland", Isocode: "IS", Language: "no", Input: "no", Books: 4, Authors: 2, Readership: population(366425)},
+		{Country: "Norway", Isocode: "NO", Language: "no", Input: "no", Books: 4, Authors: 2, Error: "Could not get population of NOR"},
+		{Country: "Svalbard and Jan Mayen Islands", Isocode: "SJ", Language: "no", Input: "no", Books: 4, Authors: 2, Readership: population(2562)},
 	}
+	if !reflect.DeepEqual(readerships, want) {
+		t.Errorf("Unexpected readerships: got %+v want %+v", readerships, want)
+	}
+}
 
-	// Expecting an array of three readership structs
-	// Here there are too many changing variables to test for exact values
-	// We can only test for the structure of the JSON
+func Test_handleReadershipGetRequestName(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	rr := httptest.NewRecorder()
+	handler.ReadershipHandler(rr, httptest.NewRequest(http.MethodGet, shared.ReadershipPath+"Norwegian?limit=1", nil))
 
-	// Decode the JSON
-	decoder := json.NewDecoder(rr.Body)
 	var readerships []shared.Readership
-	err = decoder.Decode(&readerships)
-	if err != nil {
-		t.Errorf("Failed to decode JSON: %v", err)
+	if err := json.NewDecoder(rr.Body).Decode(&readerships); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	// The name is echoed with the two letter code it resolved to
+	want := []shared.Readership{
+		{Country: "Iceland", Isocode: "IS", Language: "no", Input: "Norwegian", Books: 4, Authors: 2,
+			Readership: population(366425)},
+	}
+	if !reflect.DeepEqual(readerships, want) {
+		t.Errorf("Unexpected readerships: got %+v want %+v", readerships, want)
+	}
+}
+
+func Test_handleReadershipGetRequestGroup(t *testing.T) {
+	handler, gutendex, languages, countries := newTestHandler()
+	gutendex.Library = append(gutendex.Library,
+		shared.Book{Id: 5, Title: "Na Drini ćuprija", Languages: []string{"sr"},
+			Authors: []shared.Person{{Name: "Andrić, Ivo", BirthYear: year(1892), DeathYear: year(1975)}}},
+		shared.Book{Id: 6, Title: "Povratak Filipa Latinovicza", Languages: []string{"hr"},
+			Authors: []shared.Person{{Name: "Krleža, Miroslav", BirthYear: year(1893), DeathYear: year(1981)}}})
+	languages.Languages["hr"] = []shared.Country{{Iso31661Alpha3: "HRV", Iso31661Alpha2: "HR", OfficialName: "Croatia",
+		Language: "hr"}}
+	languages.Languages["sr"] = []shared.Country{{Iso31661Alpha3: "SRB", Iso31661Alpha2: "RS", OfficialName: "Serbia",
+		Language: "sr"}}
+	countries.Known["HRV"] = 3871833
+	countries.Known["SRB"] = 6664449
+
+	rr := httptest.NewRecorder()
+	handler.ReadershipHandler(rr, httptest.NewRequest(http.MethodGet, shared.ReadershipPath+"hr?group=macro", nil))
+
+	var readerships []shared.Readership
+	if err := json.NewDecoder(rr.Body).Decode(&readerships); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
 	}
 
+	// The countries of all members, each once, with the books of the whole group
+	members := []shared.BookCount{
+		{Language: "sh"},
+		{Language: "bs"},
+		{Language: "hr", Books: 1, Authors: 1},
+		{Language: "sr", Books: 1, Authors: 1},
+	}
+	if len(readerships) != 2 || readerships[0].Country != "Croatia" || readerships[1].Country != "Serbia" {
+		t.Fatalf("Expected Croatia and Serbia, got: %+v", readerships)
+	}
 	for _, readership := range readerships {
-		if readership.Country == "" {
-			t.Errorf("Expected country, got: %v", readership.Country)
-		} else if reflect.TypeOf(readership.Country).Kind() != reflect.String {
-			t.Errorf("Expected string, got: %v", reflect.TypeOf(readership.Country).Kind())
+		if readership.Language != "sh" || readership.Input != "hr" || readership.Books != 2 ||
+			readership.Authors != 2 || !reflect.DeepEqual(readership.Members, members) {
+			t.Errorf("Unexpected readership: %+v", readership)
 		}
+	}
+}
 
-		if readership.Isocode == "" {
-			t.Errorf("Expected isocode, got: %v", readership.Isocode)
-		} else if reflect.TypeOf(readership.Isocode).Kind() != reflect.String {
-			t.Errorf("Expected string, got: %v", reflect.TypeOf(readership.Isocode).Kind())
-		}
+func Test_getReadershipsBatch(t *testing.T) {
+	handler, _, languages, countries := newTestHandler()
 
-		if reflect.TypeOf(readership.Books).Kind() != reflect.Int {
-			t.Errorf("Expected int, got: %v", reflect.TypeOf(readership.Books).Kind())
-		}
+	readerships, failures, _ := handler.getReaderships(context.Background(), languages.Languages["no"], 4, 2)
+	if failures != 0 || len(readerships) != 3 {
+		t.Fatalf("Expected 3 readerships without failures, got: %+v, %v failures", readerships, failures)
+	}
 
-		if reflect.TypeOf(readership.Authors).Kind() != reflect.Int {
-			t.Errorf("Expected int, got: %v", reflect.TypeOf(readership.Authors).Kind())
-		}
+	// All populations are found in a single batch lookup
+	if countries.BatchCalls != 1 || countries.SingleCalls != 0 {
+		t.Errorf("Expected 1 batch and 0 single lookups, got: %v and %v", countries.BatchCalls, countries.SingleCalls)
+	}
+}
 
-		if reflect.TypeOf(readership.Readership).Kind() != reflect.Int {
-			t.Errorf("Expected int, got: %v", reflect.TypeOf(readership.Readership).Kind())
-		}
+func Test_getReadershipsBatchFallback(t *testing.T) {
+	handler, _, languages, countries := newTestHandler()
+	countries.BatchErr = errors.New("batch endpoint unavailable")
+
+	readerships, failures, _ := handler.getReaderships(context.Background(), languages.Languages["no"], 4, 2)
+	if failures != 0 || *readerships[1].Readership != 5379475 {
+		t.Fatalf("Expected readerships from single lookups, got: %+v, %v failures", readerships, failures)
 	}
 
+	// Every country is looked up on its own when the batch lookup fails
+	if countries.SingleCalls != 3 {
+		t.Errorf("Expected 3 single lookups, got: %v", countries.SingleCalls)
+	}
+}
+
+func Test_handleReadershipGetRequestErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		gutendexErr   error
+		languagesErr  error
+		countriesErr  error
+		wantProblem   util.ProblemType
+		wantParameter string
+		wantUpstream  string
+	}{
+		{"Invalid language", http.MethodGet, "no1", nil, nil, nil, util.InvalidParameter,
+			"two_letter_language_code", ""},
+		{"Unknown language", http.MethodGet, "xx", nil, nil, nil, util.UnknownLanguage, "two_letter_language_code",
+			""},
+		{"Invalid limit", http.MethodGet, "no?limit=-1", nil, nil, nil, util.InvalidParameter, "limit", ""},
+		{"No countries", http.MethodGet, "la", nil, nil, nil, util.NotFound, "two_letter_language_code", ""},
+		{"Gutendex unavailable", http.MethodGet, "no", errors.New("connection refused"), nil, nil,
+			util.UpstreamFailure, "", shared.UpstreamGutendex},
+		{"Language API unavailable", http.MethodGet, "no", nil, errors.New("connection refused"), nil,
+			util.UpstreamUnavailable, "", shared.UpstreamLanguages},
+		{"RestCountries unavailable", http.MethodGet, "no", nil, nil, errors.New("connection refused"),
+			util.UpstreamFailure, "", shared.UpstreamRestCountries},
+		{"RestCountries too slow", http.MethodGet, "no", nil, nil, context.DeadlineExceeded, util.UpstreamTimeout, "",
+			shared.UpstreamRestCountries},
+		{"Unsupported method", http.MethodDelete, "no", nil, nil, nil, util.MethodNotSupported, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, gutendex, languages, countries := newTestHandler()
+			gutendex.Err = tt.gutendexErr
+			languages.Err = tt.languagesErr
+			countries.Err = tt.countriesErr
+
+			req := httptest.NewRequest(tt.method, shared.ReadershipPath+tt.path, nil)
+			rr := httptest.NewRecorder()
+
+			util.Guard(handler.ReadershipHandler)(rr, req)
+
+			assertProblem(t, rr, tt.wantProblem, tt.wantParameter, tt.wantUpstream)
+		})
+	}
+}
+
+func Test_handleReadershipGetRequestBreakerOpen(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream string
+	}{
+		{"Language API", shared.UpstreamLanguages},
+		{"RestCountries", shared.UpstreamRestCountries},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, _, languages, countries := newTestHandler()
+			openErr := &upstream.BreakerOpenError{Upstream: tt.upstream, RetryIn: 10 * time.Second}
+			if tt.upstream == shared.UpstreamLanguages {
+				languages.Err = openErr
+			} else {
+				countries.Err = openErr
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ReadershipHandler(rr, httptest.NewRequest(http.MethodGet, shared.ReadershipPath+"no", nil))
+
+			// Fails fast with a 503 naming the dependency
+			if rr.Code != http.StatusServiceUnavailable {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusServiceUnavailable)
+			}
+			if !strings.Contains(rr.Body.String(), "'"+tt.upstream+"'") {
+				t.Errorf("Expected body naming %v, got: %q", tt.upstream, rr.Body.String())
+			}
+			if rr.Header().Get("Retry-After") != "10" {
+				t.Errorf("Expected Retry-After 10, got: %v", rr.Header().Get("Retry-After"))
+			}
+		})
+	}
 }
@@ -6,27 +6,21 @@ import (
 	"math"
 	"net/http"
 	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
 	"time"
 )
 
-var client = &http.Client{
-	Timeout: 3 * time.Second,
-}
-
-var StartTime = time.Now()
-
 // StatusHandler
 /*
 Handle requests for /status
 */
-func StatusHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) StatusHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		handleStatusGetRequest(w, r)
+		h.handleStatusGetRequest(w, r)
 	default:
-		http.Error(w, "REST Method '"+r.Method+"' not supported. Currently only '"+http.MethodGet+
-			"' are supported.", http.StatusNotImplemented)
+		util.WriteMethodNotSupported(w, r)
 		return
 	}
 
@@ -35,55 +29,39 @@ func StatusHandler(w http.ResponseWriter, r *http.Request) {
 /*
 Handle GET request for /status
 */
-func handleStatusGetRequest(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleStatusGetRequest(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("content-type", "application/json")
 
 	currentStatus := shared.Status{
-		GutendexAPI:  getStatusCode(shared.CurrentGutendexApi, w),
-		LanguageAPI:  getStatusCode(shared.LanguageApi, w),
-		CountriesAPI: getStatusCode(shared.CurrentRestCountriesApi, w),
-		Version:      shared.Version,
-		Uptime:       math.Round(time.Since(StartTime).Seconds()),
+		GutendexAPI:       h.Gutendex.StatusCode(r.Context()),
+		LanguageAPI:       h.Languages.StatusCode(r.Context()),
+		CountriesAPI:      h.Countries.StatusCode(r.Context()),
+		GutendexUpstream:  h.Gutendex.Upstream(),
+		CountriesUpstream: h.Countries.Upstream(),
+		Cache:             h.Cache.Status(),
+		Version:           shared.Version,
+		Uptime:            math.Round(time.Since(h.StartTime).Seconds()),
+	}
+
+	currentStatus.Retries = make([]shared.RetryStatus, 0, len(h.Retries))
+	for _, transport := range h.Retries {
+		currentStatus.Retries = append(currentStatus.Retries, transport.Status())
+	}
+
+	currentStatus.Breakers = make([]shared.BreakerStatus, 0, len(h.Breakers))
+	for _, breaker := range h.Breakers {
+		currentStatus.Breakers = append(currentStatus.Breakers, breaker.Status())
 	}
 
 	marshaledStatus, err := json.MarshalIndent(currentStatus, "", "\t")
 	if err != nil {
 		log.Println("Error during JSON encoding: " + err.Error())
-		http.Error(w, "Error during JSON encoding.", http.StatusInternalServerError)
+		util.WriteProblem(w, r, util.InternalError, "Error during JSON encoding.")
 		return
 	}
 
 	_, err = w.Write(marshaledStatus)
 	if err != nil {
 		log.Println("Failed to write response: " + err.Error())
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
 	}
 }
-
-/*
-Get status code from external API. Return 503 if API is not reachable.
-*/
-func getStatusCode(url string, w http.ResponseWriter) int {
-	defer client.CloseIdleConnections()
-
-	// Add language to language API, would get status 204 if not. Add /all to countries API, would get status 404 if not.
-	if url == shared.LanguageApi {
-		url = url + "/en"
-	} else if url == shared.CurrentRestCountriesApi {
-		url = url + "/all"
-	}
-
-	response, err := client.Get(url)
-	if err != nil {
-		log.Println("Error making request to external API: " + err.Error())
-		return http.StatusServiceUnavailable
-	}
-
-	err2 := response.Body.Close()
-	if err2 != nil {
-		log.Println("Error closing response body: " + err2.Error())
-		return http.StatusInternalServerError
-	}
-
-	return response.StatusCode
-}
@@ -5,27 +5,28 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"prog2005assignment1/server/shared"
-	"reflect"
+	"prog2005assignment1/server/upstream"
 	"testing"
+	"time"
 )
 
 func TestStatusHandler(t *testing.T) {
-	statusURL := "http://localhost:" + shared.DefaultPort + shared.StatusPath
+	handler, _, languages, _ := newTestHandler()
+	languages.Status = http.StatusServiceUnavailable
+	handler.Retries = []*upstream.RetryTransport{
+		upstream.NewRetryTransport(shared.UpstreamGutendex, http.DefaultTransport, upstream.RetryPolicy{}, 0),
+	}
+	handler.Breakers = []*upstream.Breaker{upstream.NewBreaker(shared.UpstreamLanguages, 5, time.Minute)}
 
 	// Test the status handler
 	// Expect a 200 OK response, with a JSON body
 	// The JSON body should contain the status of the Gutendex API, Language2Country API, RestCountries API,
 	// the version of the server and the uptime of the server
 
-	req, err := http.NewRequest("GET", statusURL, nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-
+	req := httptest.NewRequest(http.MethodGet, shared.StatusPath, nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(handleStatusGetRequest)
 
-	handler.ServeHTTP(rr, req)
+	handler.StatusHandler(rr, req)
 
 	// Test the status code
 	if status := rr.Code; status != http.StatusOK {
@@ -40,41 +41,44 @@ func TestStatusHandler(t *testing.T) {
 			contentType, expectedContentType)
 	}
 
-	// Test the JSON body
-	// Cant really test the remote APIs, but we can test the structure of the JSON, and the value types
-	// The JSON should contain the following fields: GutendexAPI, LanguageAPI, CountriesAPI, Version, Uptime
-	// The GutendexAPI, LanguageAPI and CountriesAPI should be integers
-	// The Version should be a string
-	// The Uptime should be a float64
-
 	// Decode the JSON
-	decoder := json.NewDecoder(rr.Body)
 	var status shared.Status
-	err = decoder.Decode(&status)
+	err := json.NewDecoder(rr.Body).Decode(&status)
 	if err != nil {
-		t.Errorf("Failed to decode JSON: %v", err)
+		t.Fatalf("Failed to decode JSON: %v", err)
 	}
 
 	// Test the fields
-	if reflect.TypeOf(status.GutendexAPI).Kind() != reflect.Int {
-		t.Errorf("GutendexAPI is not an integer: got %v", status.GutendexAPI)
+	if status.GutendexAPI != http.StatusOK {
+		t.Errorf("Unexpected GutendexAPI status: got %v", status.GutendexAPI)
+	}
+
+	if status.LanguageAPI != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected LanguageAPI status: got %v", status.LanguageAPI)
+	}
+
+	if status.CountriesAPI != http.StatusOK {
+		t.Errorf("Unexpected CountriesAPI status: got %v", status.CountriesAPI)
+	}
+
+	if status.GutendexUpstream.Active != "fake://gutendex/" {
+		t.Errorf("Unexpected Gutendex upstream: got %v", status.GutendexUpstream.Active)
 	}
 
-	if reflect.TypeOf(status.LanguageAPI).Kind() != reflect.Int {
-		t.Errorf("LanguageAPI is not an integer: got %v", status.LanguageAPI)
+	if len(status.Retries) != 1 || status.Retries[0].Upstream != shared.UpstreamGutendex {
+		t.Errorf("Unexpected retry status: got %+v", status.Retries)
 	}
 
-	if reflect.TypeOf(status.CountriesAPI).Kind() != reflect.Int {
-		t.Errorf("CountriesAPI is not an integer: got %v", status.CountriesAPI)
+	if len(status.Breakers) != 1 || status.Breakers[0].Upstream != shared.UpstreamLanguages ||
+		status.Breakers[0].State != upstream.StateClosed {
+		t.Errorf("Unexpected breaker status: got %+v", status.Breakers)
 	}
 
-	if reflect.TypeOf(status.Version).Kind() != reflect.String {
-		t.Errorf("Version is not a string: got %v", status.Version)
-	} else if status.Version != shared.Version {
+	if status.Version != shared.Version {
 		t.Errorf("Version is not the expected version: got %v", status.Version)
 	}
 
-	if reflect.TypeOf(status.Uptime).Kind() != reflect.Float64 {
-		t.Errorf("Uptime is not a float64: got %v", status.Uptime)
+	if status.Uptime < 0 {
+		t.Errorf("Uptime is negative: got %v", status.Uptime)
 	}
 }
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SubjectsHandler
+/*
+Handle requests for /subjects, only GET requests are supported.
+*/
+func (h *Handler) SubjectsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleTopicsGetRequest(w, r, h.Config.SubjectsPath(), func(book shared.Book) []string {
+			return book.Subjects
+		})
+	default:
+		util.WriteMethodNotSupported(w, r)
+		return
+	}
+}
+
+// BookshelvesHandler
+/*
+Handle requests for /bookshelves, only GET requests are supported.
+*/
+func (h *Handler) BookshelvesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleTopicsGetRequest(w, r, h.Config.BookshelvesPath(), func(book shared.Book) []string {
+			return book.Bookshelves
+		})
+	default:
+		util.WriteMethodNotSupported(w, r)
+		return
+	}
+}
+
+/*
+Handle GET request for /subjects/{language} or /bookshelves/{language} under path, ranking the topics of the books in
+the language, as given by topics, by their number of books. Computed from the same crawled books as bookcount.
+*/
+func (h *Handler) handleTopicsGetRequest(w http.ResponseWriter, r *http.Request, path string,
+	topics func(shared.Book) []string) {
+	w.Header().Add("content-type", "application/json")
+
+	// Get the language from the path, cut off .../subjects/ or .../bookshelves/
+	languageInput := strings.Split(strings.TrimPrefix(r.URL.Path, path), "/")[0]
+	code, ok := util.ResolveLanguage(r.Context(), h.crossCheck(), languageInput)
+	if !ok {
+		util.WriteProblemDetails(w, util.LanguageProblem(r, languageInput, "language"))
+		return
+	}
+
+	// With group=macro, the members of a macrolanguage are ranked together, e.g. sh, bs, hr and sr
+	macro, ok := parseGroup(w, r)
+	if !ok {
+		return
+	}
+	group := languageGroup(code, macro)
+
+	// Get limit from request, if not set, every topic is returned. Has to be a positive integer.
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			util.WriteProblem(w, r, util.InvalidParameter, "Invalid limit specified. Please specify a positive integer.",
+				util.Parameter("limit"))
+			return
+		}
+	}
+
+	books, freshness, err := h.getBooks(r.Context(), group)
+	if err != nil {
+		log.Println("Error during rebuilding of full result: " + err.Error())
+		util.UpstreamError(w, r, err, shared.UpstreamGutendex, "Error during rebuilding of full result",
+			http.StatusBadGateway)
+		return
+	}
+
+	counts := countTopics(books, topics)
+	ranking := shared.TopicRanking{
+		Language: group[0],
+		Input:    languageInput,
+		Books:    len(books),
+		Total:    len(counts),
+		Stale:    freshness.Stale,
+	}
+	if limit > 0 && limit < len(counts) {
+		counts = counts[:limit]
+	}
+	ranking.Counts = counts
+	setFreshnessHeaders(w, []Freshness{freshness})
+
+	marshaledRanking, err := json.MarshalIndent(ranking, "", "\t")
+	if err != nil {
+		log.Println("Error during JSON encoding: " + err.Error())
+		util.WriteProblem(w, r, util.InternalError, "Error during JSON encoding.")
+		return
+	}
+
+	_, err = w.Write(marshaledRanking)
+	if err != nil {
+		log.Println("Failed to write response: " + err.Error())
+	}
+}
+
+/*
+Count the books with each topic, as given by topics, with their share of all the books. A topic listed twice for a
+book counts once. Sorted by most books first, then by name.
+*/
+func countTopics(books []shared.Book, topics func(shared.Book) []string) []shared.TopicCount {
+	indexes := make(map[string]int)
+	counts := make([]shared.TopicCount, 0)
+	for _, book := range books {
+		counted := make(map[string]bool)
+		for _, topic := range topics(book) {
+			if counted[topic] {
+				continue
+			}
+			counted[topic] = true
+
+			index, ok := indexes[topic]
+			if !ok {
+				index = len(counts)
+				indexes[topic] = index
+				counts = append(counts, shared.TopicCount{Name: topic})
+			}
+			counts[index].Books++
+		}
+	}
+
+	for i := range counts {
+		counts[i].Fraction = fraction(counts[i].Books, len(books))
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Books != counts[j].Books {
+			return counts[i].Books > counts[j].Books
+		}
+		return counts[i].Name < counts[j].Name
+	})
+
+	return counts
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/util"
+	"reflect"
+	"testing"
+)
+
+func TestSubjectsHandler(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	rr := httptest.NewRecorder()
+	handler.SubjectsHandler(rr, httptest.NewRequest(http.MethodGet, shared.SubjectsPath+"Norwegian", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var ranking shared.TopicRanking
+	if err := json.NewDecoder(rr.Body).Decode(&ranking); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	// Ties are ranked by name
+	want := shared.TopicRanking{Language: "no", Input: "Norwegian", Books: 4, Total: 2, Counts: []shared.TopicCount{
+		{Name: "Hunger -- Fiction", Books: 1, Fraction: 0.25},
+		{Name: "Marriage -- Drama", Books: 1, Fraction: 0.25},
+	}}
+	if !reflect.DeepEqual(ranking, want) {
+		t.Errorf("Unexpected ranking: got %+v want %+v", ranking, want)
+	}
+}
+
+func TestBookshelvesHandler(t *testing.T) {
+	handler, _, _, _ := newTestHandler()
+
+	rr := httptest.NewRecorder()
+	handler.BookshelvesHandler(rr, httptest.NewRequest(http.MethodGet, shared.BookshelvesPath+"no?limit=1", nil))
+
+	var ranking shared.TopicRanking
+	if err := json.NewDecoder(rr.Body).Decode(&ranking); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if ranking.Total != 1 || len(ranking.Counts) != 1 || ranking.Counts[0].Name != "Best Books Ever Listings" ||
+		ranking.Counts[0].Fraction != 0.25 {
+		t.Errorf("Unexpected ranking: %+v", ranking)
+	}
+}
+
+func Test_countTopics(t *testing.T) {
+	books := []shared.Book{
+		{Id: 1, Subjects: []string{"Drama", "Drama", "Fiction"}},
+		{Id: 2, Subjects: []string{"Fiction"}},
+		{Id: 3},
+	}
+
+	// A subject listed twice for a book counts once, and the most common subject comes first
+	counts := countTopics(books, func(book shared.Book) []string { return book.Subjects })
+	want := []shared.TopicCount{
+		{Name: "Fiction", Books: 2, Fraction: 0.66666},
+		{Name: "Drama", Books: 1, Fraction: 0.33333},
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("Unexpected counts: got %+v want %+v", counts, want)
+	}
+}
+
+func TestTopicsHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		wantProblem   util.ProblemType
+		wantParameter string
+	}{
+		{"Unknown language", http.MethodGet, shared.SubjectsPath + "xx", util.UnknownLanguage, "language"},
+		{"Invalid limit", http.MethodGet, shared.SubjectsPath + "no?limit=0", util.InvalidParameter, "limit"},
+		{"Invalid group", http.MethodGet, shared.BookshelvesPath + "no?group=family", util.InvalidParameter, "group"},
+		{"Unsupported method", http.MethodDelete, shared.BookshelvesPath + "no", util.MethodNotSupported, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, _, _, _ := newTestHandler()
+
+			rr := httptest.NewRecorder()
+			mux := http.NewServeMux()
+			handler.Register(mux)
+			mux.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assertProblem(t, rr, tt.wantProblem, tt.wantParameter, "")
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package iso639
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"io"
+	"prog2005assignment1/server/shared"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Scopes of the languages in the registry
+const (
+	ScopeIndividual    = "individual"
+	ScopeMacrolanguage = "macrolanguage"
+	ScopeSpecial       = "special"
+	ScopeCollective    = "collective"
+)
+
+// The registry shipped with the server, one language per line, see the header of the file
+//
+//go:embed iso639.tsv
+var embedded string
+
+// Number of tab separated columns on each line of the registry
+const columns = 9
+
+// Registry struct, the ISO 639 languages, looked up by any of their codes. Safe for concurrent use, since it is never
+// changed after it is parsed.
+type Registry struct {
+	languages []shared.Language
+	byCode    map[string]int
+	byName    map[string]int
+	members   map[string][]int
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultRegistry *Registry
+)
+
+// Default
+/*
+Get the registry embedded in the server. It is parsed on first use.
+*/
+func Default() *Registry {
+	defaultOnce.Do(func() {
+		registry, err := Parse(strings.NewReader(embedded))
+		if err != nil {
+			// The embedded file is part of the source, so this is a bug, not something to recover from
+			panic("invalid embedded ISO 639 registry: " + err.Error())
+		}
+		defaultRegistry = registry
+	})
+
+	return defaultRegistry
+}
+
+// Parse
+/*
+Parse a registry from r. Every line has the tab separated columns part3, part2b, part2t, part1, scope, type,
+macrolanguage, name and native name. Empty lines and lines starting with # are skipped.
+*/
+func Parse(r io.Reader) (*Registry, error) {
+	registry := &Registry{byCode: map[string]int{}, byName: map[string]int{}, members: map[string][]int{}}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != columns {
+			return nil, errors.New("line " + strconv.Itoa(line) + ": expected " + strconv.Itoa(columns) +
+				" columns, got " + strconv.Itoa(len(fields)))
+		}
+
+		language := shared.Language{
+			Part3:         fields[0],
+			Part2B:        fields[1],
+			Part2T:        fields[2],
+			Part1:         fields[3],
+			Scope:         fields[4],
+			Type:          fields[5],
+			Macrolanguage: fields[6],
+			Name:          fields[7],
+			NativeName:    fields[8],
+		}
+		language.Code = firstNonEmpty(language.Part1, language.Part3, language.Part2T)
+		if language.Code == "" || language.Name == "" {
+			return nil, errors.New("line " + strconv.Itoa(line) + ": language without code or name")
+		}
+
+		index := len(registry.languages)
+		registry.languages = append(registry.languages, language)
+		for _, code := range []string{language.Part1, language.Part2B, language.Part2T, language.Part3} {
+			if code == "" {
+				continue
+			}
+			if other, ok := registry.byCode[code]; ok && other != index {
+				return nil, errors.New("line " + strconv.Itoa(line) + ": duplicate code '" + code + "'")
+			}
+			registry.byCode[code] = index
+		}
+		if language.Macrolanguage != "" {
+			registry.members[language.Macrolanguage] = append(registry.members[language.Macrolanguage], index)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	registry.indexNames()
+
+	return registry, nil
+}
+
+// Lookup
+/*
+Get the language with the code, which may be an ISO 639-1, 639-2 (bibliographic or terminologic) or 639-3 code, in
+any case.
+*/
+func (r *Registry) Lookup(code string) (shared.Language, bool) {
+	index, ok := r.byCode[strings.ToLower(strings.TrimSpace(code))]
+	if !ok {
+		return shared.Language{}, false
+	}
+
+	return r.languages[index], true
+}
+
+// Resolve
+/*
+Get the language with the code, or with the English or native name, in any case. Names shared by several languages
+resolve to the one with an ISO 639-1 code, otherwise to the first in the registry.
+*/
+func (r *Registry) Resolve(input string) (shared.Language, bool) {
+	if language, ok := r.Lookup(input); ok {
+		return language, true
+	}
+
+	index, ok := r.byName[normalizeName(input)]
+	if !ok {
+		return shared.Language{}, false
+	}
+
+	return r.languages[index], true
+}
+
+// Two letter codes Gutendex does not tag books with, mapped to the code of their macrolanguage it uses instead, e.g.
+// books in Bokmål and Nynorsk are tagged "no"
+var gutendexCodes = map[string]string{
+	"nb": "no",
+	"nn": "no",
+}
+
+// TwoLetterCode
+/*
+Get the ISO 639-1 code of the language, or else of its macrolanguage, e.g. "zh" for Mandarin Chinese. This is the code
+used by Gutendex, so languages Gutendex has no books under get the code of their macrolanguage, e.g. "no" for Norwegian
+Bokmål. Returns false if neither has one.
+*/
+func (r *Registry) TwoLetterCode(language shared.Language) (string, bool) {
+	if language.Part1 != "" {
+		if code, ok := gutendexCodes[language.Part1]; ok {
+			return code, true
+		}
+		return language.Part1, true
+	}
+	if language.Macrolanguage != "" {
+		if macrolanguage, ok := r.Lookup(language.Macrolanguage); ok && macrolanguage.Part1 != "" {
+			return macrolanguage.Part1, true
+		}
+	}
+
+	return "", false
+}
+
+// MacrolanguageGroup
+/*
+Get the two letter codes of the macrolanguage of the language with the two letter code, followed by the members of the
+macrolanguage with a two letter code, e.g. "sh", "bs", "hr" and "sr" for any of them. Members that Gutendex tags with
+another code are left out, e.g. the Norwegian group is only "no", since Bokmål and Nynorsk books are tagged "no".
+A language that is not part of a macrolanguage is a group of its own. The first code names the group.
+*/
+func (r *Registry) MacrolanguageGroup(code string) []string {
+	language, ok := r.Lookup(code)
+	if !ok || language.Part1 == "" {
+		return []string{code}
+	}
+
+	macrolanguage := language
+	if language.Macrolanguage != "" {
+		parent, ok := r.Lookup(language.Macrolanguage)
+		if !ok || parent.Part1 == "" {
+			return []string{language.Part1}
+		}
+		macrolanguage = parent
+	}
+
+	group := []string{macrolanguage.Part1}
+	for _, index := range r.members[macrolanguage.Part3] {
+		member := r.languages[index]
+		if _, ok := gutendexCodes[member.Part1]; member.Part1 != "" && !ok {
+			group = append(group, member.Part1)
+		}
+	}
+
+	return group
+}
+
+// Suggest
+/*
+Get at most max languages with a two letter code, whose codes or names are spelled close to input, or contain it,
+closest first. Used to help with typos, e.g. "norsc" suggests Norwegian. Inputs shorter than three letters get no
+suggestions, since almost any two letters are close to some code.
+*/
+func (r *Registry) Suggest(input string, max int) []shared.Language {
+	input = normalizeName(input)
+	if len([]rune(input)) < 3 {
+		return nil
+	}
+
+	// Allow one typo for short inputs, two for longer ones
+	allowed := 1
+	if len([]rune(input)) > 4 {
+		allowed = 2
+	}
+
+	type suggestion struct {
+		index    int
+		distance int
+	}
+	var suggestions []suggestion
+	for index, language := range r.languages {
+		if language.Part1 == "" {
+			continue
+		}
+
+		best := allowed + 1
+		for _, candidate := range []string{language.Part2B, language.Part2T, language.Part3,
+			normalizeName(trimQualifier(language.Name)), normalizeName(language.NativeName)} {
+			if candidate == "" {
+				continue
+			}
+			distance := levenshtein(input, candidate)
+			if len([]rune(input)) >= 4 && strings.Contains(candidate, input) && distance > 1 {
+				// Part of a name, e.g. "norweg" or "greek" for "Modern Greek (1453-)"
+				distance = 1
+			}
+			if distance < best {
+				best = distance
+			}
+		}
+		if best <= allowed {
+			suggestions = append(suggestions, suggestion{index: index, distance: best})
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].distance < suggestions[j].distance
+	})
+	if len(suggestions) > max {
+		suggestions = suggestions[:max]
+	}
+
+	languages := make([]shared.Language, 0, len(suggestions))
+	for _, s := range suggestions {
+		languages = append(languages, r.languages[s.index])
+	}
+
+	return languages
+}
+
+// Languages
+/*
+Get every language in the registry, in the order of the registry (by ISO 639-3 code, then the ISO 639-2 collections).
+The slice is shared, and must not be changed.
+*/
+func (r *Registry) Languages() []shared.Language {
+	return r.languages
+}
+
+/*
+Index the English and native names of the languages. Languages with an ISO 639-1 code are indexed first, so they win
+when several languages share a name.
+*/
+func (r *Registry) indexNames() {
+	for _, withPart1 := range []bool{true, false} {
+		for index, language := range r.languages {
+			if (language.Part1 != "") != withPart1 {
+				continue
+			}
+			for _, name := range []string{language.Name, language.NativeName, trimQualifier(language.Name)} {
+				name = normalizeName(name)
+				if _, taken := r.byName[name]; name != "" && !taken {
+					r.byName[name] = index
+				}
+			}
+		}
+	}
+}
+
+/*
+Normalize a language name for lookups: lower case, without surrounding space.
+*/
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+/*
+Remove a qualifier in parentheses at the end of a name, e.g. "Malay (macrolanguage)" becomes "Malay".
+*/
+func trimQualifier(name string) string {
+	if i := strings.LastIndex(name, " ("); i > 0 && strings.HasSuffix(name, ")") {
+		return name[:i]
+	}
+	return name
+}
+
+/*
+Count the edits (insertions, deletions and substitutions of a letter) needed to turn a into b.
+*/
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+/*
+Return the smallest of values.
+*/
+func minInt(values ...int) int {
+	smallest := values[0]
+	for _, value := range values[1:] {
+		if value < smallest {
+			smallest = value
+		}
+	}
+	return smallest
+}
+
+/*
+Return the first of values that is not empty.
+*/
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
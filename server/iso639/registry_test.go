@@ -0,0 +1,173 @@
+package iso639
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefault(t *testing.T) {
+	registry := Default()
+
+	tests := []struct {
+		code          string
+		wantCode      string
+		wantName      string
+		wantScope     string
+		wantMacro     string
+		wantNative    string
+		wantPart2Bibl string
+	}{
+		{"no", "no", "Norwegian", ScopeMacrolanguage, "", "Norsk", ""},
+		{"nob", "nb", "Norwegian Bokmål", ScopeIndividual, "nor", "Norsk bokmål", ""},
+		{"NN", "nn", "Norwegian Nynorsk", ScopeIndividual, "nor", "Norsk nynorsk", ""},
+		{"ger", "de", "German", ScopeIndividual, "", "Deutsch", "ger"},
+		{"deu", "de", "German", ScopeIndividual, "", "Deutsch", "ger"},
+		{"cmn", "cmn", "Mandarin Chinese", ScopeIndividual, "zho", "", ""},
+		{"ang", "ang", "Old English (ca. 450-1100)", ScopeIndividual, "", "", ""},
+		{"sla", "sla", "Slavic languages", ScopeCollective, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			language, ok := registry.Lookup(tt.code)
+			if !ok {
+				t.Fatalf("Expected %v in the registry", tt.code)
+			}
+			if language.Code != tt.wantCode || language.Name != tt.wantName || language.Scope != tt.wantScope ||
+				language.Macrolanguage != tt.wantMacro || language.NativeName != tt.wantNative ||
+				language.Part2B != tt.wantPart2Bibl {
+				t.Errorf("Unexpected language: %+v", language)
+			}
+		})
+	}
+
+	for _, code := range []string{"", "xx", "norge", "qaa"} {
+		if language, ok := registry.Lookup(code); ok {
+			t.Errorf("Expected %q not to be in the registry, got: %+v", code, language)
+		}
+	}
+}
+
+func TestDefaultPart1(t *testing.T) {
+	// Every ISO 639-1 language has a native name
+	part1 := 0
+	for _, language := range Default().Languages() {
+		if language.Part1 == "" {
+			continue
+		}
+		part1++
+		if language.NativeName == "" {
+			t.Errorf("Expected native name for %v", language.Part1)
+		}
+	}
+
+	if part1 < 180 {
+		t.Errorf("Expected all ISO 639-1 languages, got: %v", part1)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"Missing columns", "nor\t\tnor\tno\tmacrolanguage\n"},
+		{"No name", "nor\t\tnor\tno\tmacrolanguage\tliving\t\t\t\n"},
+		{"Duplicate code", "nor\t\tnor\tno\tmacrolanguage\tliving\t\tNorwegian\t\n" +
+			"nob\t\tnob\tno\tindividual\tliving\tnor\tNorwegian Bokmål\t\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader("# header\n\n" + tt.data)); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	registry := Default()
+
+	tests := []struct {
+		input    string
+		wantCode string
+		wantTwo  string
+	}{
+		{"nor", "no", "no"},
+		{"nob", "nb", "no"},
+		{"nno", "nn", "no"},
+		{"Norwegian", "no", "no"},
+		{"norsk", "no", "no"},
+		{" Norsk Bokmål ", "nb", "no"},
+		{"Deutsch", "de", "de"},
+		{"Malay", "ms", "ms"},
+		{"Mandarin Chinese", "cmn", "zh"},
+		{"ang", "ang", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			language, ok := registry.Resolve(tt.input)
+			if !ok || language.Code != tt.wantCode {
+				t.Fatalf("Expected %v, got: %+v", tt.wantCode, language)
+			}
+			if two, ok := registry.TwoLetterCode(language); two != tt.wantTwo || ok != (tt.wantTwo != "") {
+				t.Errorf("Expected two letter code %q, got: %q", tt.wantTwo, two)
+			}
+		})
+	}
+
+	if language, ok := registry.Resolve("norge"); ok {
+		t.Errorf("Expected norge not to resolve, got: %+v", language)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	registry := Default()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"norge", "no"},
+		{"englsh", "en"},
+		{"spansh", "es"},
+		{"greek", "el"},
+		{"norweg", "nn"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			suggestions := registry.Suggest(tt.input, 3)
+			if len(suggestions) == 0 || suggestions[0].Code != tt.want {
+				t.Errorf("Expected %v first, got: %+v", tt.want, suggestions)
+			}
+		})
+	}
+
+	// Two letters are close to too many codes to be useful
+	if suggestions := registry.Suggest("xx", 3); len(suggestions) != 0 {
+		t.Errorf("Expected no suggestions, got: %+v", suggestions)
+	}
+}
+
+func TestMacrolanguageGroup(t *testing.T) {
+	registry := Default()
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"no", "no"},
+		{"nn", "no"},
+		{"sr", "sh,bs,hr,sr"},
+		{"ms", "ms,id"},
+		{"zh", "zh"},
+		{"en", "en"},
+		{"xx", "xx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := strings.Join(registry.MacrolanguageGroup(tt.code), ","); got != tt.want {
+				t.Errorf("Expected %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"prog2005assignment1/server/shared"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Task func, the work a job does for a single language
+type Task func(ctx context.Context, language string) error
+
+// Job struct, used to run a task for a list of languages on startup and then on a schedule.
+// Runs are aligned to multiples of the interval, like a cron schedule (e.g. every 6h at 00:00, 06:00, ...), and
+// delayed by a random jitter so several servers do not hit the upstreams at the same time.
+type Job struct {
+	Name        string
+	languages   []string
+	interval    time.Duration
+	jitter      time.Duration
+	concurrency int
+	task        Task
+	now         func() time.Time
+
+	mu     sync.Mutex
+	status shared.JobStatus
+}
+
+// New
+/*
+Create a job called name, running task for every language, at most concurrency languages at a time.
+An interval of 0 only runs the job once on startup.
+*/
+func New(name string, languages []string, interval time.Duration, jitter time.Duration, concurrency int,
+	task Task) *Job {
+	return &Job{
+		Name:        name,
+		languages:   languages,
+		interval:    interval,
+		jitter:      jitter,
+		concurrency: concurrency,
+		task:        task,
+		now:         time.Now,
+		status:      shared.JobStatus{Name: name, Languages: languages, Failures: []shared.JobFailure{}},
+	}
+}
+
+// Run
+/*
+Run the job right away, and then on schedule until stop is closed. Intended to be run as a goroutine.
+*/
+func (j *Job) Run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		j.RunOnce(ctx)
+		if j.interval <= 0 {
+			return
+		}
+
+		next := j.next()
+		j.mu.Lock()
+		j.status.NextRun = next
+		j.mu.Unlock()
+
+		timer := time.NewTimer(next.Sub(j.now()))
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// RunOnce
+/*
+Run the task for every language, at most concurrency at a time, and record the duration and failures of the run.
+*/
+func (j *Job) RunOnce(ctx context.Context) {
+	j.mu.Lock()
+	j.status.Running = true
+	j.mu.Unlock()
+
+	start := j.now()
+	var failuresMu sync.Mutex
+	failures := []shared.JobFailure{}
+
+	// Buffered channel used as semaphore, limiting the number of languages in flight
+	semaphore := make(chan struct{}, j.concurrency)
+	var wg sync.WaitGroup
+
+	for _, language := range j.languages {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(language string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			if err := j.task(ctx, language); err != nil {
+				log.Println("Job " + j.Name + " failed for " + language + ": " + err.Error())
+				failuresMu.Lock()
+				failures = append(failures, shared.JobFailure{Language: language, Error: err.Error()})
+				failuresMu.Unlock()
+			}
+		}(language)
+	}
+	wg.Wait()
+
+	// Report failures in a stable order
+	sort.Slice(failures, func(a, b int) bool { return failures[a].Language < failures[b].Language })
+
+	duration := j.now().Sub(start)
+	log.Printf("Job %s ran for %d languages in %v, %d failed", j.Name, len(j.languages), duration, len(failures))
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Running = false
+	j.status.Runs++
+	j.status.LastRun = start
+	j.status.Duration = duration.Seconds()
+	j.status.Failures = failures
+}
+
+// Status
+/*
+Get the status of the last run of the job.
+*/
+func (j *Job) Status() shared.JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := j.status
+	status.Failures = append([]shared.JobFailure{}, j.status.Failures...)
+	return status
+}
+
+/*
+Get the time of the next run: the next multiple of the interval, plus a random jitter.
+*/
+func (j *Job) next() time.Time {
+	next := j.now().Truncate(j.interval).Add(j.interval)
+	if j.jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(j.jitter))))
+	}
+	return next
+}
@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunOnce(t *testing.T) {
+	var inFlight, maxInFlight int32
+	var mu sync.Mutex
+	seen := map[string]bool{}
+
+	job := New("warmup", []string{"no", "sv", "da", "fi", "en"}, time.Hour, 0, 2,
+		func(ctx context.Context, language string) error {
+			current := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				highest := atomic.LoadInt32(&maxInFlight)
+				if current <= highest || atomic.CompareAndSwapInt32(&maxInFlight, highest, current) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			seen[language] = true
+			mu.Unlock()
+
+			if language == "sv" || language == "da" {
+				return errors.New("upstream down")
+			}
+			return nil
+		})
+
+	job.RunOnce(context.Background())
+
+	if len(seen) != 5 {
+		t.Errorf("Expected every language to run, got: %v", seen)
+	}
+	if maxInFlight > 2 {
+		t.Errorf("Expected at most 2 languages at a time, got: %v", maxInFlight)
+	}
+
+	status := job.Status()
+	if status.Runs != 1 || status.Running || status.LastRun.IsZero() || status.Duration <= 0 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	if len(status.Failures) != 2 || status.Failures[0].Language != "da" || status.Failures[1].Language != "sv" ||
+		status.Failures[0].Error != "upstream down" {
+		t.Errorf("Expected failures for da and sv, got: %+v", status.Failures)
+	}
+}
+
+func TestRunWithoutInterval(t *testing.T) {
+	var runs int32
+	job := New("warmup", []string{"no"}, 0, 0, 1, func(ctx context.Context, language string) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+
+	// Returns after the run on startup
+	job.Run(nil)
+
+	if runs != 1 || job.Status().Runs != 1 {
+		t.Errorf("Expected a single run, got: %v", runs)
+	}
+}
+
+func TestRunStop(t *testing.T) {
+	runs := make(chan string, 10)
+	job := New("warmup", []string{"no"}, time.Hour, time.Minute, 1, func(ctx context.Context, language string) error {
+		runs <- language
+		return nil
+	})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		job.Run(stop)
+		close(done)
+	}()
+
+	<-runs
+	close(stop)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected job to stop")
+	}
+
+	if next := job.Status().NextRun; next.IsZero() {
+		t.Error("Expected next run to be scheduled")
+	}
+}
+
+func TestNext(t *testing.T) {
+	now := time.Date(2024, 2, 1, 13, 20, 0, 0, time.UTC)
+	job := New("warmup", nil, 6*time.Hour, 5*time.Minute, 1, nil)
+	job.now = func() time.Time { return now }
+
+	// Aligned to the next multiple of 6 hours, plus up to 5 minutes of jitter
+	expected := time.Date(2024, 2, 1, 18, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		next := job.next()
+		if next.Before(expected) || !next.Before(expected.Add(5*time.Minute)) {
+			t.Fatalf("Expected next run between %v and %v, got: %v", expected, expected.Add(5*time.Minute), next)
+		}
+	}
+}
@@ -1,31 +1,159 @@
 package server
 
 import (
+	"context"
 	"log"
 	"net/http"
-	"os"
+	"prog2005assignment1/server/cache"
+	"prog2005assignment1/server/clients"
+	"prog2005assignment1/server/config"
 	"prog2005assignment1/server/handlers"
+	"prog2005assignment1/server/jobs"
 	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/upstream"
+	"time"
 )
 
 // Start
 /*
-Start the server on the port specified in the environment variable PORT. If PORT is not set, the default port 8080 is used.
+Start the server. The configuration is loaded from the environment and the optional config file, see config.Load.
+If PORT is not set, the default port 8080 is used. Exits if the configuration is invalid.
 */
 func Start() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Println("$PORT has not been set. Default: " + shared.DefaultPort)
-		port = shared.DefaultPort
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Could not start server, " + err.Error())
 	}
 
+	// Clients retrying failed requests, with the policy of each upstream. The timeouts apply to every attempt.
+	// Circuit breakers per upstream, guarding the retrying transports so an open breaker is not retried
+	gutendexBreaker := upstream.NewBreaker(shared.UpstreamGutendex, cfg.BreakerThreshold,
+		cfg.BreakerOpenTimeout.Duration)
+	languagesBreaker := upstream.NewBreaker(shared.UpstreamLanguages, cfg.BreakerThreshold,
+		cfg.BreakerOpenTimeout.Duration)
+	countriesBreaker := upstream.NewBreaker(shared.UpstreamRestCountries, cfg.BreakerThreshold,
+		cfg.BreakerOpenTimeout.Duration)
+
+	gutendexTransport := newRetryTransport(cfg, shared.UpstreamGutendex, shared.UpstreamGutendex,
+		cfg.UpstreamTimeout.Duration)
+	languagesTransport := newRetryTransport(cfg, shared.UpstreamLanguages, shared.UpstreamLanguages,
+		cfg.UpstreamTimeout.Duration)
+	checkTransport := newRetryTransport(cfg, shared.UpstreamLanguages+"-check", shared.UpstreamLanguages,
+		cfg.LanguageCheckTimeout.Duration)
+	countriesTransport := newRetryTransport(cfg, shared.UpstreamRestCountries, shared.UpstreamRestCountries,
+		cfg.UpstreamTimeout.Duration)
+
+	// Health checks are not retried, a single failure is enough to keep using the fallback
+	probeClient := &http.Client{Timeout: cfg.UpstreamTimeout.Duration}
+
+	// Upstream pools for the services that have a remote mirror. The probes ask for a single book or country,
+	// to keep health checks cheap.
+	gutendexPool := upstream.NewPool(shared.UpstreamGutendex, cfg.GutendexApi, cfg.GutendexApiRemote, "?ids=1")
+	countriesPool := upstream.NewPool(shared.UpstreamRestCountries, cfg.RestCountriesApi, cfg.RestCountriesApiRemote,
+		"/alpha/no")
+
+	// Fail back to the primary upstreams once they recover. Runs for the lifetime of the server.
+	go gutendexPool.Monitor(probeClient, cfg.HealthCheckInterval.Duration, nil)
+	go countriesPool.Monitor(probeClient, cfg.HealthCheckInterval.Duration, nil)
+
+	// Optional cache on disk, so the cached data survives restarts
+	var store *cache.Store
+	if cfg.CacheDir != "" {
+		store, err = cache.NewStore(cfg.CacheDir)
+		if err != nil {
+			log.Fatal("Could not start server, " + err.Error())
+		}
+	}
+
+	// The language check shares the breaker of the language API, since it is the same service
+	languagesClient := &http.Client{Transport: languagesBreaker.Transport(languagesTransport)}
+	checkClient := &http.Client{Transport: languagesBreaker.Transport(checkTransport)}
+	countriesClient := &http.Client{Transport: countriesBreaker.Transport(countriesTransport)}
+	gutendexClient := &http.Client{Transport: gutendexBreaker.Transport(gutendexTransport)}
+
+	languages := clients.NewCachedLanguages(clients.NewHTTPLanguages(languagesClient, checkClient, cfg.LanguageApi),
+		cfg.CacheTTL.Duration, store)
+	countries := clients.NewCachedCountries(clients.NewHTTPCountries(countriesClient, countriesPool),
+		cfg.CacheTTL.Duration, store)
+	gutendex := clients.NewHTTPGutendex(gutendexClient, gutendexPool)
+
+	handler := handlers.New(cfg, gutendex, languages, countries)
+	handler.Store = store
+	handler.Retries = []*upstream.RetryTransport{gutendexTransport, languagesTransport, checkTransport,
+		countriesTransport}
+	handler.Breakers = []*upstream.Breaker{gutendexBreaker, languagesBreaker, countriesBreaker}
+	restoreCache(handler, languages, countries)
+	startWarmup(cfg, handler)
+
 	// Set up handler endpoints
-	http.HandleFunc(shared.DefaultPath, handlers.DefaultHandler)
-	http.HandleFunc(shared.StatusPath, handlers.StatusHandler)
-	http.HandleFunc(shared.ReadershipPath, handlers.ReadershipHandler)
-	http.HandleFunc(shared.BookCountPath, handlers.BookCountHandler)
+	mux := http.NewServeMux()
+	handler.Register(mux)
 
 	// Start server
-	log.Println("Starting server on port " + port + " ...")
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Println("Starting server on port " + cfg.Port + " with base path " + cfg.BasePath + " ...")
+	log.Fatal(http.ListenAndServe(":"+cfg.Port, mux))
+}
+
+/*
+Create a transport called name, retrying requests with the configured policy of the upstream, giving every attempt at
+most attemptTimeout.
+*/
+func newRetryTransport(cfg *config.Config, name string, upstreamName string,
+	attemptTimeout time.Duration) *upstream.RetryTransport {
+	policy := cfg.Retry[upstreamName]
+	return upstream.NewRetryTransport(name, http.DefaultTransport, upstream.RetryPolicy{
+		MaxAttempts:     policy.MaxAttempts,
+		BaseDelay:       policy.BaseDelay.Duration,
+		MaxDelay:        policy.MaxDelay.Duration,
+		Deadline:        policy.Deadline.Duration,
+		RetryableStatus: policy.RetryableStatus,
+	}, attemptTimeout)
+}
+
+/*
+Load the cache saved on disk, if any, and refresh expired entries in the background, so the first requests after a
+restart are answered from the cache instead of waiting for the upstreams.
+*/
+func restoreCache(handler *handlers.Handler, languages *clients.CachedLanguages, countries *clients.CachedCountries) {
+	if handler.Store == nil {
+		return
+	}
+
+	staleBooks, err := handler.LoadStore()
+	if err != nil {
+		log.Println("Could not load cached books: " + err.Error())
+	}
+	staleCountries, err := languages.Load()
+	if err != nil {
+		log.Println("Could not load cached countries: " + err.Error())
+	}
+	stalePopulations, err := countries.Load()
+	if err != nil {
+		log.Println("Could not load cached populations: " + err.Error())
+	}
+
+	log.Printf("Loaded cache from disk, refreshing %d languages, %d country lists and %d populations in the background",
+		len(staleBooks), len(staleCountries), len(stalePopulations))
+
+	go func() {
+		ctx := context.Background()
+		handler.RefreshLanguages(ctx, staleBooks)
+		languages.Refresh(ctx, staleCountries)
+		countries.Refresh(ctx, stalePopulations)
+	}()
+}
+
+/*
+Start the warm-up job for the configured languages, if any. It fetches the languages on startup and then on the
+configured interval, so they are always answered from the cache. Runs for the lifetime of the server.
+*/
+func startWarmup(cfg *config.Config, handler *handlers.Handler) {
+	if len(cfg.WarmupLanguages) == 0 {
+		return
+	}
+
+	warmup := jobs.New("warmup", cfg.WarmupLanguages, cfg.WarmupInterval.Duration, cfg.WarmupJitter.Duration,
+		cfg.WarmupConcurrency, handler.WarmLanguage)
+	handler.Jobs = append(handler.Jobs, warmup)
+	go warmup.Run(nil)
 }
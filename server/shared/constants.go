@@ -5,11 +5,30 @@ const DefaultPath = "/"
 const DefaultPort = "8080"
 const Version = "v1"
 const LibraryStatsPath = "/librarystats/" + Version
-const BookCountPath = LibraryStatsPath + "/bookcount/"
-const ReadershipPath = LibraryStatsPath + "/readership/"
-const StatusPath = LibraryStatsPath + "/status/"
 
-// External API endpoints hosted by Christopher
+// Endpoints, relative to the base path (LibraryStatsPath unless configured otherwise)
+const BookCountEndpoint = "/bookcount/"
+const ReadershipEndpoint = "/readership/"
+const StatusEndpoint = "/status/"
+const JobsEndpoint = "/jobs/"
+const LanguagesEndpoint = "/languages/"
+const AuthorsEndpoint = "/authors/"
+const BooksEndpoint = "/books/"
+const SubjectsEndpoint = "/subjects/"
+const BookshelvesEndpoint = "/bookshelves/"
+
+// Default paths for the endpoints
+const BookCountPath = LibraryStatsPath + BookCountEndpoint
+const ReadershipPath = LibraryStatsPath + ReadershipEndpoint
+const StatusPath = LibraryStatsPath + StatusEndpoint
+const JobsPath = LibraryStatsPath + JobsEndpoint
+const LanguagesPath = LibraryStatsPath + LanguagesEndpoint
+const AuthorsPath = LibraryStatsPath + AuthorsEndpoint
+const BooksPath = LibraryStatsPath + BooksEndpoint
+const SubjectsPath = LibraryStatsPath + SubjectsEndpoint
+const BookshelvesPath = LibraryStatsPath + BookshelvesEndpoint
+
+// External API endpoints hosted by Christopher, used as defaults. Can be overridden in the configuration.
 const GutendexApi = "http://129.241.150.113:8000/books/"
 const RestCountriesApi = "http://129.241.150.113:8080/v3.1"
 const LanguageApi = "http://129.241.150.113:3000/language2countries/"
@@ -18,6 +37,10 @@ const LanguageApi = "http://129.241.150.113:3000/language2countries/"
 const GutendexApiRemote = "https://gutendex.com/books/"
 const RestCountriesApiRemote = "https://restcountries.com/v3.1/"
 
-// Constants for the current API in use, because Christopher's API is not always available
-const CurrentGutendexApi = GutendexApi
-const CurrentRestCountriesApi = RestCountriesApi
+// Names of the upstream services, used in logs, status and the retry configuration
+const UpstreamGutendex = "gutendex"
+const UpstreamLanguages = "languages"
+const UpstreamRestCountries = "restcountries"
+
+// Prefix of the type of every problem returned by the server, followed by the name of the problem
+const ProblemTypePrefix = "urn:librarystats:problem:"
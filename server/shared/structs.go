@@ -1,43 +1,266 @@
 package shared
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // Status struct, used to return status information about the server
 type Status struct {
-	GutendexAPI  int     `json:"gutendexapi"`
-	LanguageAPI  int     `json:"languageapi"`
-	CountriesAPI int     `json:"countriesapi"`
-	Version      string  `json:"version"`
-	Uptime       float64 `json:"uptime"`
+	GutendexAPI       int             `json:"gutendexapi"`
+	LanguageAPI       int             `json:"languageapi"`
+	CountriesAPI      int             `json:"countriesapi"`
+	GutendexUpstream  UpstreamStatus  `json:"gutendexupstream"`
+	CountriesUpstream UpstreamStatus  `json:"countriesupstream"`
+	Cache             CacheStatus     `json:"cache"`
+	Retries           []RetryStatus   `json:"retries"`
+	Breakers          []BreakerStatus `json:"breakers"`
+	Version           string          `json:"version"`
+	Uptime            float64         `json:"uptime"`
+}
+
+// UpstreamStatus struct, used to report which upstream (primary or remote fallback) is in use for a service
+type UpstreamStatus struct {
+	Active         string    `json:"active"`
+	Fallback       bool      `json:"fallback"`
+	LastTransition time.Time `json:"lasttransition"`
+}
+
+// CacheStatus struct, used to report the size and effectiveness of the Gutendex cache
+type CacheStatus struct {
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"maxbytes"`
+	Hits      int64 `json:"hits"`
+	StaleHits int64 `json:"stalehits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// RetryStatus struct, used to report how often requests to an upstream were retried.
+// Exhausted counts requests that still failed after all attempts.
+type RetryStatus struct {
+	Upstream  string `json:"upstream"`
+	Requests  int64  `json:"requests"`
+	Retries   int64  `json:"retries"`
+	Exhausted int64  `json:"exhausted"`
+}
+
+// BreakerStatus struct, used to report the state of the circuit breaker of an upstream.
+// State is closed, open or half-open, Failures is the number of failed requests in a row.
+type BreakerStatus struct {
+	Upstream       string    `json:"upstream"`
+	State          string    `json:"state"`
+	Failures       int       `json:"failures"`
+	LastTransition time.Time `json:"lasttransition"`
+}
+
+// JobStatus struct, used to report the last run of a background job.
+// LastRun and Duration are zero until the first run has finished, Duration is in seconds.
+type JobStatus struct {
+	Name      string       `json:"name"`
+	Languages []string     `json:"languages"`
+	Running   bool         `json:"running"`
+	Runs      int          `json:"runs"`
+	LastRun   time.Time    `json:"lastrun"`
+	Duration  float64      `json:"duration"`
+	NextRun   time.Time    `json:"nextrun"`
+	Failures  []JobFailure `json:"failures"`
 }
 
-// BookCount struct, used to return book count information
+// JobFailure struct, used to report a language that failed during the last run of a job
+type JobFailure struct {
+	Language string `json:"language"`
+	Error    string `json:"error"`
+}
+
+// Problem struct, used to return errors as RFC 7807 problem details (application/problem+json).
+// Parameter names the offending request parameter, Upstream the upstream service that failed, and Suggestions lists
+// the language codes an unknown language may have been meant as.
+type Problem struct {
+	Type        string   `json:"type"`
+	Title       string   `json:"title"`
+	Status      int      `json:"status"`
+	Detail      string   `json:"detail"`
+	Instance    string   `json:"instance,omitempty"`
+	Parameter   string   `json:"parameter,omitempty"`
+	Upstream    string   `json:"upstream,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// Language struct, a language of the ISO 639 registry. Code is the shortest code of the language: the ISO 639-1 code
+// if it has one, otherwise its ISO 639-3 code, or its ISO 639-2 code for collections of languages. Macrolanguage is the
+// ISO 639-3 code of the macrolanguage the language belongs to, if any.
+type Language struct {
+	Code          string `json:"code"`
+	Part1         string `json:"part1,omitempty"`
+	Part2B        string `json:"part2b,omitempty"`
+	Part2T        string `json:"part2t,omitempty"`
+	Part3         string `json:"part3,omitempty"`
+	Name          string `json:"name"`
+	NativeName    string `json:"nativename,omitempty"`
+	Scope         string `json:"scope"`
+	Type          string `json:"type,omitempty"`
+	Macrolanguage string `json:"macrolanguage,omitempty"`
+}
+
+// BookCount struct, used to return book count information.
+// Language is the two letter code of the language, Input the language as requested, e.g. "Norwegian" for "no".
+// Stale is set if the numbers come from an expired cache entry that is being refreshed.
+// Members is the breakdown by language when the members of a macrolanguage are counted together.
+// Downloads is only set with include=downloads.
 type BookCount struct {
+	Language  string      `json:"language"`
+	Input     string      `json:"input,omitempty"`
+	Books     int         `json:"books"`
+	Authors   int         `json:"authors"`
+	Fraction  float64     `json:"fraction"`
+	Downloads *Downloads  `json:"downloads,omitempty"`
+	Stale     bool        `json:"stale,omitempty"`
+	Members   []BookCount `json:"members,omitempty"`
+}
+
+// Downloads struct, used to return the downloads of the books in a language from Gutendex. Median and Mean are the
+// downloads per book, and Top the most downloaded books.
+type Downloads struct {
+	Total  int              `json:"total"`
+	Median float64          `json:"median"`
+	Mean   float64          `json:"mean"`
+	Top    []DownloadedBook `json:"top"`
+}
+
+// DownloadedBook struct, used to return a book with its number of downloads.
+type DownloadedBook struct {
+	Id        int    `json:"id"`
+	Title     string `json:"title"`
+	Downloads int    `json:"downloads"`
+}
+
+// BookCountResult struct, the result for one requested language: its book count, or the error explaining why there is
+// none. Marshals as a BookCount, or as a LanguageError if Error is set.
+type BookCountResult struct {
+	BookCount
+	Error *Problem `json:"error,omitempty"`
+}
+
+// MarshalJSON
+/*
+Marshal the result as the book count, or as the language and its error.
+*/
+func (r BookCountResult) MarshalJSON() ([]byte, error) {
+	if r.Error != nil {
+		return json.Marshal(LanguageError{Language: r.Language, Error: *r.Error})
+	}
+	return json.Marshal(r.BookCount)
+}
+
+// LanguageError struct, the error for a requested language without a book count
+type LanguageError struct {
 	Language string  `json:"language"`
+	Error    Problem `json:"error"`
+}
+
+// BookCountEnvelope struct, the bookcount response in envelope mode. Partial is set if some, but not all, of the
+// requested languages failed.
+type BookCountEnvelope struct {
+	Partial bool            `json:"partial"`
+	Results []BookCount     `json:"results"`
+	Errors  []LanguageError `json:"errors"`
+}
+
+// Readership struct, used to return readership information.
+// Readership is null and Error is set if the population of the country could not be found.
+// Language is the two letter code of the language, Input the language as requested.
+// Members is the breakdown by language when the members of a macrolanguage are counted together.
+// Stale is set if the book and author counts come from an expired cache entry that is being refreshed.
+type Readership struct {
+	Country    string      `json:"country"`
+	Isocode    string      `json:"isocode"`
+	Language   string      `json:"language"`
+	Input      string      `json:"input,omitempty"`
+	Books      int         `json:"books"`
+	Authors    int         `json:"authors"`
+	Readership *int        `json:"readership"`
+	Error      string      `json:"error,omitempty"`
+	Stale      bool        `json:"stale,omitempty"`
+	Members    []BookCount `json:"members,omitempty"`
+}
+
+// Author struct, used to return an author of books in a language. BirthYear and DeathYear are null if unknown.
+type Author struct {
+	Name      string `json:"name"`
+	BirthYear *int   `json:"birthyear"`
+	DeathYear *int   `json:"deathyear"`
+	Books     int    `json:"books"`
+}
+
+// AuthorPage struct, used to return a page of the authors of books in a language. Total is the number of authors on
+// all pages.
+type AuthorPage struct {
+	Language string   `json:"language"`
+	Input    string   `json:"input,omitempty"`
+	Total    int      `json:"total"`
+	Page     int      `json:"page"`
+	Limit    int      `json:"limit"`
+	Sort     string   `json:"sort"`
+	Order    string   `json:"order"`
+	Authors  []Author `json:"authors"`
+	Stale    bool     `json:"stale,omitempty"`
+}
+
+// TopicCount struct, used to return the number of books in a language with a subject or on a bookshelf. Fraction is
+// their share of the books in the language.
+type TopicCount struct {
+	Name     string  `json:"name"`
 	Books    int     `json:"books"`
-	Authors  int     `json:"authors"`
 	Fraction float64 `json:"fraction"`
 }
 
-// Readership struct, used to return readership information
-type Readership struct {
-	Country    string `json:"country"`
-	Isocode    string `json:"isocode"`
-	Books      int    `json:"books"`
-	Authors    int    `json:"authors"`
-	Readership int    `json:"readership"`
+// TopicRanking struct, used to return the subjects or bookshelves of the books in a language, most books first. Books
+// is the number of books in the language, and Total the number of subjects or bookshelves before any limit.
+type TopicRanking struct {
+	Language string       `json:"language"`
+	Input    string       `json:"input,omitempty"`
+	Books    int          `json:"books"`
+	Total    int          `json:"total"`
+	Counts   []TopicCount `json:"counts"`
+	Stale    bool         `json:"stale,omitempty"`
 }
 
-// Book struct, used to decode JSON from Gutendex API
-type Book struct {
-	Id        int      `json:"id"`
-	Title     string   `json:"title"`
-	Authors   []Person `json:"authors"`
+// BookPage struct, used to return a page of the books in one or more languages. Total is the number of books matching
+// the filters on all pages, and Next the cursor of the next page, empty on the last page.
+type BookPage struct {
 	Languages []string `json:"languages"`
+	Total     int      `json:"total"`
+	Limit     int      `json:"limit"`
+	Sort      string   `json:"sort"`
+	Order     string   `json:"order"`
+	Next      string   `json:"next,omitempty"`
+	Books     []Book   `json:"books"`
+	Stale     bool     `json:"stale,omitempty"`
+}
+
+// Book struct, used to decode JSON from Gutendex API. Copyright is null if unknown, and Formats maps MIME types to
+// download URLs.
+type Book struct {
+	Id            int               `json:"id"`
+	Title         string            `json:"title"`
+	Authors       []Person          `json:"authors"`
+	Translators   []Person          `json:"translators"`
+	Subjects      []string          `json:"subjects"`
+	Bookshelves   []string          `json:"bookshelves"`
+	Languages     []string          `json:"languages"`
+	Copyright     *bool             `json:"copyright"`
+	MediaType     string            `json:"media_type"`
+	Formats       map[string]string `json:"formats"`
+	DownloadCount int               `json:"download_count"`
 }
 
-// Person struct, used to decode JSON from Gutendex API
+// Person struct, used to decode JSON from Gutendex API. BirthYear and DeathYear are null if unknown, and negative for
+// years BCE.
 type Person struct {
-	BirthYear int    `json:"birth_year"`
-	DeathYear int    `json:"death_year"`
+	BirthYear *int   `json:"birth_year"`
+	DeathYear *int   `json:"death_year"`
 	Name      string `json:"name"`
 }
 
@@ -61,5 +284,6 @@ type Country struct {
 
 // CountryFromRestCountries struct, used to decode JSON from RestCountries API
 type CountryFromRestCountries struct {
-	Population int `json:"population"`
+	Cca3       string `json:"cca3"`
+	Population int    `json:"population"`
 }
@@ -0,0 +1,217 @@
+package upstream
+
+import (
+	"log"
+	"net/http"
+	"prog2005assignment1/server/shared"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// States of a circuit breaker
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+// BreakerOpenError struct, returned instead of sending a request while the breaker of the upstream is open
+type BreakerOpenError struct {
+	Upstream string
+	RetryIn  time.Duration
+}
+
+// Error
+/*
+Describe the open breaker, naming the upstream.
+*/
+func (e *BreakerOpenError) Error() string {
+	return "circuit breaker for " + e.Upstream + " is open, retry in " +
+		strconv.Itoa(int(e.RetryIn.Round(time.Second).Seconds())) + "s"
+}
+
+// Breaker struct, a circuit breaker for an upstream service.
+// While closed, requests are sent as usual. After threshold failures in a row the breaker opens, and requests fail
+// right away without being sent. Once openTimeout has passed, the breaker is half-open and lets a single request
+// through: if it succeeds the breaker closes, otherwise it opens again. Safe for concurrent use.
+type Breaker struct {
+	Name        string
+	threshold   int
+	openTimeout time.Duration
+	now         func() time.Time
+
+	mu             sync.Mutex
+	state          string
+	failures       int
+	probing        bool
+	openedAt       time.Time
+	lastTransition time.Time
+}
+
+// NewBreaker
+/*
+Create a closed breaker for the upstream called name, opening after threshold failures in a row and staying open for
+openTimeout.
+*/
+func NewBreaker(name string, threshold int, openTimeout time.Duration) *Breaker {
+	return &Breaker{
+		Name:           name,
+		threshold:      threshold,
+		openTimeout:    openTimeout,
+		now:            time.Now,
+		state:          StateClosed,
+		lastTransition: time.Now(),
+	}
+}
+
+// Transport
+/*
+Wrap next, so every request sent through it is guarded by the breaker. Several transports can share a breaker, e.g.
+clients with different timeouts for the same upstream.
+*/
+func (b *Breaker) Transport(next http.RoundTripper) http.RoundTripper {
+	return &breakerTransport{breaker: b, next: next}
+}
+
+// Allow
+/*
+Check if a request may be sent. Returns a *BreakerOpenError if not. Every allowed request has to be followed by a call
+to Done with its outcome.
+*/
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		elapsed := b.now().Sub(b.openedAt)
+		if elapsed < b.openTimeout {
+			return &BreakerOpenError{Upstream: b.Name, RetryIn: b.openTimeout - elapsed}
+		}
+		b.transition(StateHalfOpen)
+	}
+
+	if b.state == StateHalfOpen {
+		// Only a single request probes the upstream, the others fail fast until it is done
+		if b.probing {
+			return &BreakerOpenError{Upstream: b.Name, RetryIn: time.Second}
+		}
+		b.probing = true
+	}
+
+	return nil
+}
+
+// Done
+/*
+Record the outcome of a request allowed by Allow.
+*/
+func (b *Breaker) Done(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.probing = false
+		if success {
+			b.failures = 0
+			b.transition(StateClosed)
+		} else {
+			b.open()
+		}
+		return
+	}
+
+	if success {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == StateClosed && b.failures >= b.threshold {
+		b.open()
+	}
+}
+
+// Status
+/*
+Get the state of the breaker, when it last changed, and the number of failures in a row.
+*/
+func (b *Breaker) Status() shared.BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// An open breaker whose timeout has passed lets the next request through
+	state := b.state
+	if state == StateOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		state = StateHalfOpen
+	}
+
+	return shared.BreakerStatus{
+		Upstream:       b.Name,
+		State:          state,
+		Failures:       b.failures,
+		LastTransition: b.lastTransition,
+	}
+}
+
+/*
+Forget a request allowed by Allow without recording an outcome, so another request may probe a half-open breaker.
+*/
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+/*
+Open the breaker. The caller must hold the lock.
+*/
+func (b *Breaker) open() {
+	b.openedAt = b.now()
+	b.transition(StateOpen)
+}
+
+/*
+Change the state of the breaker. The caller must hold the lock.
+*/
+func (b *Breaker) transition(state string) {
+	if b.state == state {
+		return
+	}
+
+	log.Println("Circuit breaker for " + b.Name + " changed from " + b.state + " to " + state)
+	b.state = state
+	b.lastTransition = b.now()
+}
+
+// breakerTransport struct, an http.RoundTripper guarded by a breaker
+type breakerTransport struct {
+	breaker *Breaker
+	next    http.RoundTripper
+}
+
+// RoundTrip
+/*
+Send the request if the breaker allows it. Network errors and 5xx responses count as failures, requests cancelled by
+the caller, or past the deadline of the caller, count as neither. Timeouts of single attempts still count, since they
+are set below the breaker.
+*/
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	res, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		// The caller gave up or ran out of time, this says nothing about the upstream. Let the next request decide.
+		t.breaker.release()
+	case err != nil:
+		t.breaker.Done(false)
+	default:
+		t.breaker.Done(res.StatusCode < http.StatusInternalServerError)
+	}
+
+	return res, err
+}
@@ -0,0 +1,181 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerTrips(t *testing.T) {
+	status, hits := int32(http.StatusInternalServerError), int32(0)
+	server := newCountingServer(t, &status, &hits)
+
+	now := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+	breaker := NewBreaker("test", 3, 30*time.Second)
+	breaker.now = func() time.Time { return now }
+	client := &http.Client{Transport: breaker.Transport(http.DefaultTransport)}
+
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if state := breaker.Status(); state.State != StateOpen || !state.LastTransition.Equal(now) {
+		t.Fatalf("Expected breaker to open after 3 failures, got: %+v", state)
+	}
+
+	// Open: fails fast without sending the request
+	_, err := client.Get(server.URL)
+	var openErr *BreakerOpenError
+	if !errors.As(err, &openErr) || openErr.Upstream != "test" || openErr.RetryIn != 30*time.Second {
+		t.Fatalf("Expected breaker open error, got: %v", err)
+	}
+	if hits != 3 {
+		t.Errorf("Expected no request while open, got: %v", hits)
+	}
+
+	// Half-open after the timeout, a failed probe opens it again
+	now = now.Add(31 * time.Second)
+	if state := breaker.Status().State; state != StateHalfOpen {
+		t.Errorf("Expected half-open breaker, got: %v", state)
+	}
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if state := breaker.Status().State; state != StateOpen || hits != 4 {
+		t.Errorf("Expected breaker to open again after failed probe, got: %v after %v requests", state, hits)
+	}
+
+	// A successful probe closes it
+	now = now.Add(31 * time.Second)
+	atomic.StoreInt32(&status, http.StatusOK)
+	res, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if state := breaker.Status(); state.State != StateClosed || state.Failures != 0 {
+		t.Errorf("Expected breaker to close after successful probe, got: %+v", state)
+	}
+}
+
+func TestBreakerSuccessResets(t *testing.T) {
+	breaker := NewBreaker("test", 2, time.Minute)
+
+	// Failures have to be in a row
+	for _, success := range []bool{false, true, false, true, false} {
+		if err := breaker.Allow(); err != nil {
+			t.Fatal(err)
+		}
+		breaker.Done(success)
+	}
+
+	if state := breaker.Status(); state.State != StateClosed || state.Failures != 1 {
+		t.Errorf("Expected closed breaker with 1 failure, got: %+v", state)
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	now := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+	breaker := NewBreaker("test", 1, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	_ = breaker.Allow()
+	breaker.Done(false)
+	now = now.Add(2 * time.Minute)
+
+	// Only the first request probes the half-open breaker
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected probe to be allowed, got: %v", err)
+	}
+	if err := breaker.Allow(); err == nil {
+		t.Error("Expected second request to fail fast while probing")
+	}
+
+	// A probe cancelled by the caller lets the next request probe
+	breaker.release()
+	if err := breaker.Allow(); err != nil {
+		t.Errorf("Expected new probe after release, got: %v", err)
+	}
+}
+
+func TestBreakerIgnoresCancelled(t *testing.T) {
+	breaker := NewBreaker("test", 1, time.Minute)
+	client := &http.Client{Transport: breaker.Transport(http.DefaultTransport)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://127.0.0.1:1/", nil)
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("Expected error for cancelled request")
+	}
+
+	if state := breaker.Status(); state.State != StateClosed || state.Failures != 0 {
+		t.Errorf("Expected cancelled request not to count, got: %+v", state)
+	}
+}
+
+func TestBreakerIgnoresCallerDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	// The deadline of the caller passes while the upstream is still working
+	breaker := NewBreaker("test", 1, time.Minute)
+	client := &http.Client{Transport: breaker.Transport(http.DefaultTransport)}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("Expected error for request past its deadline")
+	}
+	if state := breaker.Status(); state.State != StateClosed || state.Failures != 0 {
+		t.Errorf("Expected request past the deadline of the caller not to count, got: %+v", state)
+	}
+
+	// A single attempt timing out is the upstream being slow, and counts
+	client.Transport = breaker.Transport(NewRetryTransport("test", http.DefaultTransport, RetryPolicy{MaxAttempts: 1},
+		20*time.Millisecond))
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("Expected error for attempt timing out")
+	}
+	if state := breaker.Status(); state.State != StateOpen {
+		t.Errorf("Expected attempt timing out to open the breaker, got: %+v", state)
+	}
+}
+
+func TestPoolBreakerOpen(t *testing.T) {
+	primaryStatus, fallbackStatus := int32(http.StatusOK), int32(http.StatusOK)
+	var primaryHits, fallbackHits int32
+	primary := newCountingServer(t, &primaryStatus, &primaryHits)
+	fallback := newCountingServer(t, &fallbackStatus, &fallbackHits)
+
+	breaker := NewBreaker("test", 1, time.Minute)
+	_ = breaker.Allow()
+	breaker.Done(false)
+
+	pool := NewPool("test", primary.URL+"/", fallback.URL+"/", "")
+	client := &http.Client{Transport: breaker.Transport(http.DefaultTransport)}
+
+	// An open breaker is not a reason to fail over
+	if _, err := pool.Get(context.Background(), client, "books"); err == nil {
+		t.Fatal("Expected error while breaker is open")
+	}
+	if pool.Status().Fallback || primaryHits != 0 || fallbackHits != 0 {
+		t.Errorf("Expected no failover and no requests, got fallback=%v primary=%v fallback=%v",
+			pool.Status().Fallback, primaryHits, fallbackHits)
+	}
+}
@@ -0,0 +1,205 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"prog2005assignment1/server/shared"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pool struct, used to send requests to a primary upstream with a remote mirror as fallback.
+// The pool switches to the fallback when the primary fails, and back once a health check sees the primary again.
+type Pool struct {
+	Name      string
+	primary   string
+	fallback  string
+	probePath string
+
+	mu             sync.RWMutex
+	usingFallback  bool
+	lastTransition time.Time
+}
+
+// NewPool
+/*
+Create a new pool for the upstream service called name. probePath is appended to the primary base URL by health checks,
+and should be a cheap request that returns 200 when the service works.
+*/
+func NewPool(name string, primary string, fallback string, probePath string) *Pool {
+	return &Pool{
+		Name:      name,
+		primary:   primary,
+		fallback:  fallback,
+		probePath: probePath,
+	}
+}
+
+// Active
+/*
+Return the base URL of the upstream currently in use.
+*/
+func (p *Pool) Active() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.usingFallback {
+		return p.fallback
+	}
+	return p.primary
+}
+
+// Status
+/*
+Return the current state of the pool.
+*/
+func (p *Pool) Status() shared.UpstreamStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	status := shared.UpstreamStatus{
+		Active:         p.primary,
+		Fallback:       p.usingFallback,
+		LastTransition: p.lastTransition,
+	}
+	if p.usingFallback {
+		status.Active = p.fallback
+	}
+
+	return status
+}
+
+// Get
+/*
+Make a GET request to path, relative to the active upstream. If the primary is active and the request fails with a
+network error or a 5xx status, the pool switches to the fallback and the request is repeated there.
+*/
+func (p *Pool) Get(ctx context.Context, client *http.Client, path string) (*http.Response, error) {
+	p.mu.RLock()
+	usingFallback := p.usingFallback
+	p.mu.RUnlock()
+
+	if usingFallback {
+		return get(ctx, client, join(p.fallback, path))
+	}
+
+	res, err := get(ctx, client, join(p.primary, path))
+	if err == nil && res.StatusCode < http.StatusInternalServerError {
+		return res, nil
+	}
+
+	// The client gave up, this says nothing about the health of the primary
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// The breaker guards the whole service, the fallback would be rejected as well
+	var openErr *BreakerOpenError
+	if errors.As(err, &openErr) {
+		return nil, err
+	}
+
+	if err != nil {
+		log.Println("Request to primary " + p.Name + " upstream failed: " + err.Error())
+	} else {
+		log.Println("Request to primary " + p.Name + " upstream failed with status " + res.Status)
+		res.Body.Close()
+	}
+
+	p.setFallback(true)
+	return get(ctx, client, join(p.fallback, path))
+}
+
+// Check
+/*
+Probe the primary upstream and switch between primary and fallback accordingly. Nothing changes if ctx is cancelled
+during the probe.
+*/
+func (p *Pool) Check(ctx context.Context, client *http.Client) {
+	healthy := false
+
+	res, err := get(ctx, client, join(p.primary, p.probePath))
+	if err == nil {
+		healthy = res.StatusCode < http.StatusInternalServerError
+		res.Body.Close()
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	p.setFallback(!healthy)
+}
+
+// Monitor
+/*
+Check the primary upstream every interval, until stop is closed. A probe in progress is cancelled when stop is
+closed. Intended to be run as a goroutine.
+*/
+func (p *Pool) Monitor(client *http.Client, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.Check(ctx, client)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+/*
+Switch to or from the fallback, logging the transition if the state changes.
+*/
+func (p *Pool) setFallback(fallback bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.usingFallback == fallback {
+		return
+	}
+
+	p.usingFallback = fallback
+	p.lastTransition = time.Now()
+	if fallback {
+		log.Println("Switching " + p.Name + " upstream to fallback " + p.fallback)
+	} else {
+		log.Println("Switching " + p.Name + " upstream back to primary " + p.primary)
+	}
+}
+
+/*
+Make a GET request bound to ctx.
+*/
+func get(ctx context.Context, client *http.Client, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req)
+}
+
+/*
+Join a base URL and a path, avoiding double slashes. Paths starting with "?" are appended as is.
+*/
+func join(base string, path string) string {
+	if strings.HasSuffix(base, "/") && strings.HasPrefix(path, "/") {
+		return base + path[1:]
+	}
+	return base + path
+}
@@ -0,0 +1,80 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+/*
+Create a test server answering with status, counting the requests it receives.
+*/
+func newCountingServer(t *testing.T, status *int32, hits *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		w.WriteHeader(int(atomic.LoadInt32(status)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPoolFailover(t *testing.T) {
+	primaryStatus, fallbackStatus := int32(http.StatusOK), int32(http.StatusOK)
+	var primaryHits, fallbackHits int32
+	primary := newCountingServer(t, &primaryStatus, &primaryHits)
+	fallback := newCountingServer(t, &fallbackStatus, &fallbackHits)
+
+	pool := NewPool("test", primary.URL+"/books/", fallback.URL+"/books/", "?ids=1")
+	client := primary.Client()
+
+	// Primary is healthy, no fallback
+	res, err := pool.Get(context.Background(), client, "?languages=no")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if atomic.LoadInt32(&primaryHits) != 1 || atomic.LoadInt32(&fallbackHits) != 0 || pool.Status().Fallback {
+		t.Errorf("Expected request to primary only, got primary=%v fallback=%v", primaryHits, fallbackHits)
+	}
+
+	// Primary fails, request is repeated on fallback and the pool stays there
+	atomic.StoreInt32(&primaryStatus, http.StatusBadGateway)
+	res, err = pool.Get(context.Background(), client, "?languages=no")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected fallback to answer 200, got: %v", res.StatusCode)
+	}
+	if !pool.Status().Fallback || pool.Active() != fallback.URL+"/books/" {
+		t.Errorf("Expected fallback to be active, got: %v", pool.Active())
+	}
+
+	// Primary still down, health check keeps fallback
+	pool.Check(context.Background(), client)
+	if !pool.Status().Fallback {
+		t.Error("Expected fallback to stay active while primary is down")
+	}
+
+	// Primary recovers, health check fails back
+	atomic.StoreInt32(&primaryStatus, http.StatusOK)
+	pool.Check(context.Background(), client)
+	if pool.Status().Fallback || pool.Active() != primary.URL+"/books/" {
+		t.Errorf("Expected primary to be active again, got: %v", pool.Active())
+	}
+	if pool.Status().LastTransition.IsZero() {
+		t.Error("Expected last transition to be set")
+	}
+}
+
+func TestJoin(t *testing.T) {
+	if got := join("https://restcountries.com/v3.1/", "/alpha/no"); got != "https://restcountries.com/v3.1/alpha/no" {
+		t.Errorf("join() = %v", got)
+	}
+	if got := join("http://host/v3.1", "/alpha/no"); got != "http://host/v3.1/alpha/no" {
+		t.Errorf("join() = %v", got)
+	}
+}
@@ -0,0 +1,243 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"prog2005assignment1/server/shared"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Longest response body drained before a retry, so the connection can be reused
+const maxDrain = 64 << 10
+
+// RetryPolicy struct, how requests to an upstream are retried.
+// The delay before retry n is BaseDelay*2^(n-1), capped at MaxDelay, with a random jitter of up to half the delay.
+// Deadline bounds all attempts together, including the delays.
+type RetryPolicy struct {
+	MaxAttempts     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	Deadline        time.Duration
+	RetryableStatus []int
+}
+
+// RetryTransport struct, an http.RoundTripper retrying failed requests to an upstream with exponential backoff.
+// Network errors, timed out attempts and responses with a retryable status are retried. Only idempotent requests are
+// retried, see idempotent. Safe for concurrent use.
+type RetryTransport struct {
+	Name           string
+	base           http.RoundTripper
+	policy         RetryPolicy
+	attemptTimeout time.Duration
+
+	requests  int64
+	retries   int64
+	exhausted int64
+}
+
+// NewRetryTransport
+/*
+Create a transport for the upstream called name, sending requests through base with the retry policy. Every attempt
+is given at most attemptTimeout, 0 means no limit besides the deadline of the policy.
+*/
+func NewRetryTransport(name string, base http.RoundTripper, policy RetryPolicy,
+	attemptTimeout time.Duration) *RetryTransport {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+
+	return &RetryTransport{Name: name, base: base, policy: policy, attemptTimeout: attemptTimeout}
+}
+
+// RoundTrip
+/*
+Send the request, retrying it as configured by the policy. Returns the response of the last attempt, which can have a
+retryable status if all attempts failed.
+*/
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.requests, 1)
+
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.policy.Deadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.policy.Deadline)
+	}
+
+	attempts := t.policy.MaxAttempts
+	if !idempotent(req) {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancelAttempt := ctx, context.CancelFunc(func() {})
+		if t.attemptTimeout > 0 {
+			attemptCtx, cancelAttempt = context.WithTimeout(ctx, t.attemptTimeout)
+		}
+
+		attemptReq, err := clone(attemptCtx, req, attempt)
+		if err != nil {
+			cancelAttempt()
+			cancel()
+			return nil, err
+		}
+
+		res, err := t.base.RoundTrip(attemptReq)
+		reason := t.retryReason(ctx, res, err)
+
+		delay := t.delay(attempt, res)
+		last := attempt >= attempts
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			// No time left for another attempt
+			last = true
+		}
+
+		if reason == "" || last {
+			if reason != "" && attempts > 1 {
+				atomic.AddInt64(&t.exhausted, 1)
+				log.Printf("Giving up on %s %s %s after %d attempts: %s", t.Name, req.Method, req.URL, attempt, reason)
+			}
+			if err != nil {
+				cancelAttempt()
+				cancel()
+				return nil, err
+			}
+
+			// The contexts have to live until the body is read
+			res.Body = &cancelBody{ReadCloser: res.Body, cancel: func() { cancelAttempt(); cancel() }}
+			return res, nil
+		}
+
+		if res != nil {
+			_, _ = io.CopyN(io.Discard, res.Body, maxDrain)
+			res.Body.Close()
+		}
+		cancelAttempt()
+
+		atomic.AddInt64(&t.retries, 1)
+		log.Printf("Retrying %s %s %s in %v (attempt %d of %d): %s", t.Name, req.Method, req.URL, delay,
+			attempt+1, attempts, reason)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			cancel()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Status
+/*
+Get the number of requests, retries, and requests that failed after all attempts.
+*/
+func (t *RetryTransport) Status() shared.RetryStatus {
+	return shared.RetryStatus{
+		Upstream:  t.Name,
+		Requests:  atomic.LoadInt64(&t.requests),
+		Retries:   atomic.LoadInt64(&t.retries),
+		Exhausted: atomic.LoadInt64(&t.exhausted),
+	}
+}
+
+/*
+Get the reason to retry an attempt, or "" if it should not be retried. Attempts are not retried once ctx, which holds
+the deadline of the whole request, is done.
+*/
+func (t *RetryTransport) retryReason(ctx context.Context, res *http.Response, err error) string {
+	if ctx.Err() != nil {
+		return ""
+	}
+	if err != nil {
+		return err.Error()
+	}
+
+	for _, status := range t.policy.RetryableStatus {
+		if res.StatusCode == status {
+			return "status " + res.Status
+		}
+	}
+	return ""
+}
+
+/*
+Get the delay before the attempt after attempt: exponential backoff with jitter, or the Retry-After of the response
+if that is longer. Never longer than MaxDelay.
+*/
+func (t *RetryTransport) delay(attempt int, res *http.Response) time.Duration {
+	delay := t.policy.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > t.policy.MaxDelay {
+		// Also catches overflow of the shift
+		delay = t.policy.MaxDelay
+	}
+	if delay > 1 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+
+	if res != nil {
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+			if retryAfter := time.Duration(seconds) * time.Second; retryAfter > delay {
+				delay = retryAfter
+			}
+		}
+	}
+
+	if delay > t.policy.MaxDelay {
+		delay = t.policy.MaxDelay
+	}
+	return delay
+}
+
+/*
+Check if the request can safely be sent more than once: an idempotent method, or an Idempotency-Key set by the caller.
+*/
+func idempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// The body can not be sent again
+		return false
+	}
+
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return req.Header.Get("Idempotency-Key") != ""
+	}
+}
+
+/*
+Copy the request for attempt number attempt, bound to ctx. The body is fetched again for every attempt after the first.
+*/
+func clone(ctx context.Context, req *http.Request, attempt int) (*http.Request, error) {
+	attemptReq := req.Clone(ctx)
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, errors.New("could not get body to retry request: " + err.Error())
+		}
+		attemptReq.Body = body
+	}
+	return attemptReq, nil
+}
+
+// cancelBody struct, a response body that cancels the contexts of the request when it is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close
+/*
+Close the body and cancel the contexts of the request.
+*/
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,222 @@
+package upstream
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Policy retrying quickly, so the tests do not wait for the backoff
+var testPolicy = RetryPolicy{
+	MaxAttempts:     3,
+	BaseDelay:       time.Millisecond,
+	MaxDelay:        5 * time.Millisecond,
+	Deadline:        5 * time.Second,
+	RetryableStatus: []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+}
+
+/*
+Create a test server failing with status for the first failures requests, and answering "ok" after that.
+*/
+func newFlakyServer(t *testing.T, failures int32, status int, hits *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(hits, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRetryTransportRecovers(t *testing.T) {
+	var hits int32
+	server := newFlakyServer(t, 2, http.StatusServiceUnavailable, &hits)
+	transport := NewRetryTransport("test", http.DefaultTransport, testPolicy, time.Second)
+	client := &http.Client{Transport: transport}
+
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("Expected 200 ok after retries, got: %v %q", res.StatusCode, body)
+	}
+	if hits != 3 {
+		t.Errorf("Expected 3 attempts, got: %v", hits)
+	}
+	if status := transport.Status(); status.Requests != 1 || status.Retries != 2 || status.Exhausted != 0 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestRetryTransportExhausted(t *testing.T) {
+	var hits int32
+	server := newFlakyServer(t, 10, http.StatusBadGateway, &hits)
+	transport := NewRetryTransport("test", http.DefaultTransport, testPolicy, time.Second)
+	client := &http.Client{Transport: transport}
+
+	// The response of the last attempt is returned
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusBadGateway || hits != 3 {
+		t.Errorf("Expected 502 after 3 attempts, got: %v after %v", res.StatusCode, hits)
+	}
+	if status := transport.Status(); status.Retries != 2 || status.Exhausted != 1 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestRetryTransportNotRetryable(t *testing.T) {
+	var hits int32
+	server := newFlakyServer(t, 10, http.StatusNotFound, &hits)
+	client := &http.Client{Transport: NewRetryTransport("test", http.DefaultTransport, testPolicy, time.Second)}
+
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusNotFound || hits != 1 {
+		t.Errorf("Expected a single 404, got: %v after %v", res.StatusCode, hits)
+	}
+}
+
+func TestRetryTransportIdempotency(t *testing.T) {
+	var hits int32
+	server := newFlakyServer(t, 10, http.StatusServiceUnavailable, &hits)
+	client := &http.Client{Transport: NewRetryTransport("test", http.DefaultTransport, testPolicy, time.Second)}
+
+	// POST is not retried
+	res, err := client.Post(server.URL, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if hits != 1 {
+		t.Errorf("Expected POST to be sent once, got: %v", hits)
+	}
+
+	// Unless it has an idempotency key
+	atomic.StoreInt32(&hits, 0)
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("{}"))
+	req.Header.Set("Idempotency-Key", "1")
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if hits != 3 {
+		t.Errorf("Expected POST with idempotency key to be retried, got: %v", hits)
+	}
+}
+
+func TestRetryTransportAttemptTimeout(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt hangs until it times out
+		if atomic.AddInt32(&hits, 1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+
+	client := &http.Client{Transport: NewRetryTransport("test", http.DefaultTransport, testPolicy,
+		50*time.Millisecond)}
+
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || hits != 2 {
+		t.Errorf("Expected 200 on second attempt, got: %v after %v", res.StatusCode, hits)
+	}
+}
+
+func TestRetryTransportDeadline(t *testing.T) {
+	var hits int32
+	server := newFlakyServer(t, 100, http.StatusServiceUnavailable, &hits)
+
+	policy := testPolicy
+	policy.MaxAttempts = 100
+	policy.BaseDelay = 20 * time.Millisecond
+	policy.MaxDelay = 20 * time.Millisecond
+	policy.Deadline = 100 * time.Millisecond
+	client := &http.Client{Transport: NewRetryTransport("test", http.DefaultTransport, policy, time.Second)}
+
+	start := time.Now()
+	res, err := client.Get(server.URL)
+	if err == nil {
+		res.Body.Close()
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected retries to stop at the deadline, took: %v", elapsed)
+	}
+	if hits >= 100 {
+		t.Errorf("Expected fewer attempts than max attempts, got: %v", hits)
+	}
+}
+
+func TestRetryTransportCancelled(t *testing.T) {
+	var hits int32
+	server := newFlakyServer(t, 100, http.StatusServiceUnavailable, &hits)
+
+	policy := testPolicy
+	policy.BaseDelay = time.Hour
+	policy.MaxDelay = time.Hour
+	policy.Deadline = 0
+	client := &http.Client{Transport: NewRetryTransport("test", http.DefaultTransport, policy, time.Second)}
+
+	// Cancelled while waiting for the next attempt
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+
+	if _, err := client.Do(req); err == nil {
+		t.Error("Expected error when cancelled")
+	}
+	if hits != 1 {
+		t.Errorf("Expected a single attempt, got: %v", hits)
+	}
+}
+
+func TestRetryTransportDelay(t *testing.T) {
+	transport := NewRetryTransport("test", http.DefaultTransport, RetryPolicy{
+		MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second,
+	}, 0)
+
+	// Exponential, with up to half of the delay as jitter, capped at MaxDelay
+	for attempt, expected := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond,
+		10: time.Second} {
+		delay := transport.delay(attempt, nil)
+		if delay < expected/2 || delay > expected {
+			t.Errorf("Expected delay after attempt %v between %v and %v, got: %v", attempt, expected/2, expected,
+				delay)
+		}
+	}
+
+	// Retry-After is honoured, up to MaxDelay
+	res := &http.Response{Header: http.Header{"Retry-After": []string{"30"}}}
+	if delay := transport.delay(1, res); delay != time.Second {
+		t.Errorf("Expected Retry-After capped at 1s, got: %v", delay)
+	}
+}
@@ -1,43 +1,125 @@
 package util
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"prog2005assignment1/server/clients"
+	"prog2005assignment1/server/iso639"
 	"prog2005assignment1/server/shared"
-	"time"
+	"strings"
 	"unicode"
 )
 
-var client = &http.Client{
-	Timeout: 1 * time.Second,
-}
+// Most suggestions given for an unknown language
+const maxSuggestions = 3
 
 // LanguageCodeChecker
 /*
-Check if the language code is valid. Returns a boolean indicating if the language code is valid.
-Can also return an error to the client if there's an error with the request to the external API.
+Check if the language code is the two letter ISO 639-1 code of a known language, using the ISO 639 registry embedded
+in the server. If crossCheck is not nil, the Language2Country API is asked as well, and any disagreement is logged.
+The registry has the final say either way, so languages are validated even while the API is down.
 */
-func LanguageCodeChecker(languageCode string, responseWriter http.ResponseWriter) bool {
-	if len(languageCode) != 2 || !unicode.IsLetter(rune(languageCode[0])) || !unicode.IsLetter(rune(languageCode[1])) {
+func LanguageCodeChecker(ctx context.Context, crossCheck clients.LanguageClient, languageCode string) bool {
+	if !ValidLanguageCode(languageCode) {
 		log.Println("Invalid request. Invalid language code.")
 		return false
 	}
 
-	// Make request to Language2Country API, if 204 is returned, the language is not valid
-	res, err := client.Get(shared.LanguageApi + "/" + languageCode)
-	if err != nil {
-		log.Println("Error when checking Language2Country API:", err.Error())
-		http.Error(responseWriter, "Error when checking external API", http.StatusServiceUnavailable)
-		return false
+	_, known := iso639.Default().Lookup(languageCode)
+
+	if crossCheck != nil {
+		knownByAPI, err := crossCheck.Known(ctx, languageCode)
+		switch {
+		case err != nil:
+			log.Println("Could not cross-check language " + languageCode + " with Language2Country API: " +
+				err.Error())
+		case knownByAPI != known:
+			log.Println("Language2Country API disagrees with the ISO 639 registry about " + languageCode +
+				", using the registry")
+		}
+	}
+
+	return known
+}
+
+// ResolveLanguage
+/*
+Resolve a language as typed by the user, e.g. "no", "nor", "nob", "Norwegian" or "norsk", to the two letter code used
+by Gutendex, and check that code with LanguageCodeChecker. Three letter codes and names of languages without a two
+letter code resolve to the code of their macrolanguage, if it has one. Returns false if the language can not be
+resolved, see LanguageProblem for why.
+*/
+func ResolveLanguage(ctx context.Context, crossCheck clients.LanguageClient, input string) (string, bool) {
+	registry := iso639.Default()
+
+	language, ok := registry.Resolve(input)
+	if !ok {
+		return "", false
+	}
+	code, ok := registry.TwoLetterCode(language)
+	if !ok {
+		return "", false
+	}
+
+	return code, LanguageCodeChecker(ctx, crossCheck, code)
+}
+
+// LanguageProblem
+/*
+Create the problem for a language that ResolveLanguage could not resolve, for the request parameter named parameter.
+Input that can not be a code or a name is an invalid-parameter, anything else an unknown-language, with suggestions
+for near-miss spellings.
+*/
+func LanguageProblem(r *http.Request, input string, parameter string) shared.Problem {
+	if !ValidLanguageInput(input) {
+		return NewProblem(r, InvalidParameter, "Invalid language '"+input+"'. Please specify a language code or "+
+			"the name of a language.", Parameter(parameter))
 	}
-	if res.StatusCode == 204 {
-		// Service is available, but the language code is not valid
+
+	registry := iso639.Default()
+	if language, ok := registry.Resolve(input); ok {
+		return NewProblem(r, UnknownLanguage, "Language '"+input+"' ("+language.Name+") has no two letter code, "+
+			"so the library has no books in it.", Parameter(parameter))
+	}
+
+	var suggestions, names []string
+	for _, language := range registry.Suggest(input, maxSuggestions) {
+		suggestions = append(suggestions, language.Code)
+		names = append(names, language.Code+" ("+language.Name+")")
+	}
+
+	detail := "Unknown language '" + input + "'."
+	if len(names) > 0 {
+		detail += " Did you mean " + strings.Join(names, ", ") + "?"
+	}
+
+	return NewProblem(r, UnknownLanguage, detail, Parameter(parameter), Suggestions(suggestions))
+}
+
+// ValidLanguageCode
+/*
+Check if the language code looks like a two letter ISO 639-1 code, without checking whether the language exists.
+*/
+func ValidLanguageCode(languageCode string) bool {
+	return len(languageCode) == 2 && unicode.IsLetter(rune(languageCode[0])) && unicode.IsLetter(rune(languageCode[1]))
+}
+
+// ValidLanguageInput
+/*
+Check if the input looks like a language code or the name of a language: letters, spaces, hyphens, apostrophes and
+parentheses, without checking whether the language exists.
+*/
+func ValidLanguageInput(input string) bool {
+	if strings.TrimSpace(input) == "" || len([]rune(input)) > 64 {
 		return false
-	} else if res.StatusCode == 200 {
-		// Service is available and the language code is valid
-		return true
 	}
 
-	// If the status code is not 204 or 200, return false
-	return false
+	for _, r := range input {
+		if !unicode.IsLetter(r) && !unicode.IsMark(r) && !strings.ContainsRune(" -'()", r) {
+			return false
+		}
+	}
+
+	return true
 }
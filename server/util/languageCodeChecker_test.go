@@ -1,31 +1,111 @@
 package util
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"prog2005assignment1/server/clients"
+	"prog2005assignment1/server/shared"
+	"reflect"
 	"testing"
 )
 
 // TestLanguageCodeChecker tests the LanguageCodeChecker function
 func TestLanguageCodeChecker(t *testing.T) {
-	type args struct {
-		languageCode   string
-		responseWriter http.ResponseWriter
-	}
 	tests := []struct {
-		name string
-		args args
-		want bool
+		name         string
+		languageCode string
+		want         bool
 	}{
-		{"Valid language code", args{"en", nil}, true},
-		{"Invalid language code", args{"eng", nil}, false},
-		{"Invalid language code", args{"e", nil}, false},
-		{"Invalid language code", args{"", nil}, false},
+		{"Valid language code", "en", true},
+		{"Valid language code", "nb", true},
+		{"Unknown language code", "xx", false},
+		{"Invalid language code", "eng", false},
+		{"Invalid language code", "e", false},
+		{"Invalid language code", "", false},
+		{"Invalid language code", "e1", false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := LanguageCodeChecker(tt.args.languageCode, tt.args.responseWriter); got != tt.want {
+			if got := LanguageCodeChecker(context.Background(), nil, tt.languageCode); got != tt.want {
 				t.Errorf("LanguageCodeChecker() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+// TestLanguageCodeCheckerCrossCheck tests that the registry decides, whatever the Language2Country API answers
+func TestLanguageCodeCheckerCrossCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		languages *clients.FakeLanguages
+	}{
+		{"API agrees", &clients.FakeLanguages{Languages: map[string][]shared.Country{"en": {}}}},
+		{"API disagrees", &clients.FakeLanguages{Languages: map[string][]shared.Country{"xx": {}}}},
+		{"API unavailable", &clients.FakeLanguages{Err: errors.New("connection refused")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !LanguageCodeChecker(context.Background(), tt.languages, "en") {
+				t.Error("Expected en to be known")
+			}
+			if LanguageCodeChecker(context.Background(), tt.languages, "xx") {
+				t.Error("Expected xx to be unknown")
+			}
+		})
+	}
+}
+
+// TestResolveLanguage tests that codes and names resolve to the two letter code
+func TestResolveLanguage(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"no", "no"},
+		{"nor", "no"},
+		{"nob", "no"},
+		{"nb", "no"},
+		{"Norwegian Nynorsk", "no"},
+		{"Norwegian", "no"},
+		{"norsk", "no"},
+		{"cmn", "zh"},
+		{"ang", ""},
+		{"norge", ""},
+		{"e1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			code, ok := ResolveLanguage(context.Background(), nil, tt.input)
+			if code != tt.want || ok != (tt.want != "") {
+				t.Errorf("ResolveLanguage() = %q, %v, want %q", code, ok, tt.want)
+			}
+		})
+	}
+}
+
+// TestLanguageProblem tests the problem for each way a language can fail to resolve
+func TestLanguageProblem(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/librarystats/v1/bookcount/?language=norge", nil)
+
+	tests := []struct {
+		input           string
+		wantKind        ProblemType
+		wantSuggestions []string
+	}{
+		{"e1", InvalidParameter, nil},
+		{"ang", UnknownLanguage, nil},
+		{"norge", UnknownLanguage, []string{"no"}},
+		{"xx", UnknownLanguage, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			problem := LanguageProblem(r, tt.input, "language")
+			if problem.Type != ProblemTypeURI(tt.wantKind) || problem.Parameter != "language" ||
+				!reflect.DeepEqual(problem.Suggestions, tt.wantSuggestions) {
+				t.Errorf("Unexpected problem: %+v", problem)
+			}
+		})
+	}
+}
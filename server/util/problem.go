@@ -0,0 +1,238 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/upstream"
+	"strconv"
+)
+
+// ProblemType struct, a kind of error, with the title and status of its problem details
+type ProblemType struct {
+	Name   string
+	Title  string
+	Status int
+}
+
+// The kinds of errors returned by the endpoints
+var (
+	InvalidParameter    = ProblemType{"invalid-parameter", "Invalid parameter", http.StatusBadRequest}
+	NotFound            = ProblemType{"not-found", "Not found", http.StatusNotFound}
+	UnknownLanguage     = ProblemType{"unknown-language", "Unknown language", http.StatusNotFound}
+	MethodNotSupported  = ProblemType{"method-not-supported", "Method not supported", http.StatusNotImplemented}
+	InternalError       = ProblemType{"internal-error", "Internal server error", http.StatusInternalServerError}
+	UpstreamFailure     = ProblemType{"upstream-failure", "Upstream service failed", http.StatusBadGateway}
+	UpstreamUnavailable = ProblemType{"upstream-unavailable", "Upstream service unavailable",
+		http.StatusServiceUnavailable}
+	UpstreamTimeout = ProblemType{"upstream-timeout", "Upstream service timed out", http.StatusGatewayTimeout}
+)
+
+// ProblemTypeURI
+/*
+Get the type URI of the problems of the kind.
+*/
+func ProblemTypeURI(kind ProblemType) string {
+	return shared.ProblemTypePrefix + kind.Name
+}
+
+// ProblemOption func, used to add optional fields to a problem
+type ProblemOption func(problem *shared.Problem)
+
+// Parameter
+/*
+Name the request parameter that caused the problem.
+*/
+func Parameter(name string) ProblemOption {
+	return func(problem *shared.Problem) {
+		problem.Parameter = name
+	}
+}
+
+// Upstream
+/*
+Name the upstream service that caused the problem.
+*/
+func Upstream(name string) ProblemOption {
+	return func(problem *shared.Problem) {
+		problem.Upstream = name
+	}
+}
+
+// Suggestions
+/*
+List the language codes the offending language may have been meant as.
+*/
+func Suggestions(codes []string) ProblemOption {
+	return func(problem *shared.Problem) {
+		problem.Suggestions = codes
+	}
+}
+
+// NewProblem
+/*
+Create the problem details of the kind for the request, with detail describing what went wrong.
+*/
+func NewProblem(r *http.Request, kind ProblemType, detail string, options ...ProblemOption) shared.Problem {
+	problem := shared.Problem{
+		Type:     ProblemTypeURI(kind),
+		Title:    kind.Title,
+		Status:   kind.Status,
+		Detail:   detail,
+		Instance: r.URL.RequestURI(),
+	}
+	for _, option := range options {
+		option(&problem)
+	}
+
+	return problem
+}
+
+// WriteProblem
+/*
+Write an error response as problem details of the kind, with detail describing what went wrong. This is the only way
+the endpoints report errors. Within Guard, nothing is written if the response has already started, and nothing
+written after the problem reaches the client, so every request gets at most one error.
+*/
+func WriteProblem(w http.ResponseWriter, r *http.Request, kind ProblemType, detail string, options ...ProblemOption) {
+	WriteProblemDetails(w, NewProblem(r, kind, detail, options...))
+}
+
+// WriteProblemDetails
+/*
+Write problem as the error response, like WriteProblem.
+*/
+func WriteProblemDetails(w http.ResponseWriter, problem shared.Problem) {
+	guarded, isGuarded := w.(*guardedWriter)
+	if isGuarded && guarded.started {
+		log.Println("Response already started, dropping problem: " + problem.Detail)
+		return
+	}
+
+	body, err := json.MarshalIndent(problem, "", "\t")
+	if err != nil {
+		// Can not happen for a struct of strings and ints, but never leave the client without a status
+		log.Println("Error during JSON encoding of problem: " + err.Error())
+		body = []byte("{}")
+	}
+
+	w.Header().Set("content-type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if _, err = w.Write(body); err != nil {
+		log.Println("Failed to write problem: " + err.Error())
+	}
+
+	if isGuarded {
+		guarded.problem = true
+	}
+}
+
+// UpstreamError
+/*
+Write the problem for a failed request to the upstream service named upstreamName, as made by UpstreamProblem. If the
+circuit breaker of the upstream is open, a Retry-After header is set as well. If the client went away, nothing is
+written.
+*/
+func UpstreamError(w http.ResponseWriter, r *http.Request, err error, upstreamName string, detail string, status int) {
+	if errors.Is(err, context.Canceled) {
+		log.Println("Client went away, not writing response")
+		return
+	}
+
+	problem, retryAfter := UpstreamProblem(r, err, upstreamName, detail, status)
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	WriteProblemDetails(w, problem)
+}
+
+// UpstreamProblem
+/*
+Create the problem for a failed request to the upstream service named upstreamName. If the circuit breaker of the
+upstream is open, the problem is upstream-unavailable, and the number of seconds until it may close is returned as
+well. If the deadline of the request passed, the problem is upstream-timeout. Otherwise the problem is
+upstream-unavailable for status 503 and upstream-failure for anything else.
+*/
+func UpstreamProblem(r *http.Request, err error, upstreamName string, detail string, status int) (shared.Problem,
+	int) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewProblem(r, UpstreamTimeout, "The request did not finish in time, the upstream services are slow. "+
+			"Please try again later.", Upstream(upstreamName)), 0
+	}
+
+	var openErr *upstream.BreakerOpenError
+	if errors.As(err, &openErr) {
+		log.Println("Failing fast: " + openErr.Error())
+		retryAfter := int(math.Ceil(openErr.RetryIn.Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		return NewProblem(r, UpstreamUnavailable, "Upstream service '"+openErr.Upstream+"' is unavailable (circuit "+
+			"breaker open). Try again in "+strconv.Itoa(retryAfter)+" seconds.", Upstream(openErr.Upstream)), retryAfter
+	}
+
+	kind := UpstreamFailure
+	if status == http.StatusServiceUnavailable {
+		kind = UpstreamUnavailable
+	}
+	return NewProblem(r, kind, detail, Upstream(upstreamName)), 0
+}
+
+// WriteMethodNotSupported
+/*
+Write the problem for a request with a method other than GET, the only method supported by the endpoints.
+*/
+func WriteMethodNotSupported(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", http.MethodGet)
+	WriteProblem(w, r, MethodNotSupported, "REST Method '"+r.Method+"' not supported. Currently only '"+
+		http.MethodGet+"' is supported.")
+}
+
+// Guard
+/*
+Wrap next, so a problem written with WriteProblem is the only error written for the request: a problem is dropped if
+the response has already started, and anything written after a problem is dropped.
+*/
+func Guard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(&guardedWriter{ResponseWriter: w}, r)
+	}
+}
+
+// guardedWriter struct, an http.ResponseWriter remembering whether the response has started, and whether it is a
+// problem
+type guardedWriter struct {
+	http.ResponseWriter
+	started bool
+	problem bool
+}
+
+// WriteHeader
+/*
+Write the status, unless it has been written already.
+*/
+func (g *guardedWriter) WriteHeader(status int) {
+	if g.started {
+		return
+	}
+	g.started = true
+	g.ResponseWriter.WriteHeader(status)
+}
+
+// Write
+/*
+Write to the body, unless a problem has been written.
+*/
+func (g *guardedWriter) Write(body []byte) (int, error) {
+	if g.problem {
+		log.Println("Dropping output written after a problem")
+		return len(body), nil
+	}
+	g.started = true
+	return g.ResponseWriter.Write(body)
+}
@@ -0,0 +1,141 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"prog2005assignment1/server/shared"
+	"prog2005assignment1/server/upstream"
+	"reflect"
+	"testing"
+	"time"
+)
+
+/*
+Decode the single problem written to rr.
+*/
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) shared.Problem {
+	t.Helper()
+
+	var problem shared.Problem
+	decoder := json.NewDecoder(rr.Body)
+	if err := decoder.Decode(&problem); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	if decoder.More() {
+		t.Errorf("Expected a single problem, got more output")
+	}
+	return problem
+}
+
+func TestWriteProblem(t *testing.T) {
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/librarystats/v1/readership/no?limit=-1", nil)
+
+	WriteProblem(rr, r, InvalidParameter, "Invalid limit specified.", Parameter("limit"))
+
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("content-type") != "application/problem+json" {
+		t.Errorf("Unexpected response: %v %v", rr.Code, rr.Header().Get("content-type"))
+	}
+
+	want := shared.Problem{
+		Type:      "urn:librarystats:problem:invalid-parameter",
+		Title:     "Invalid parameter",
+		Status:    http.StatusBadRequest,
+		Detail:    "Invalid limit specified.",
+		Instance:  "/librarystats/v1/readership/no?limit=-1",
+		Parameter: "limit",
+	}
+	if problem := decodeProblem(t, rr); !reflect.DeepEqual(problem, want) {
+		t.Errorf("Unexpected problem: got %+v want %+v", problem, want)
+	}
+}
+
+func TestUpstreamError(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		status       int
+		wantProblem  ProblemType
+		wantUpstream string
+	}{
+		{"Failure", errors.New("connection refused"), http.StatusBadGateway, UpstreamFailure, "gutendex"},
+		{"Unavailable", errors.New("connection refused"), http.StatusServiceUnavailable, UpstreamUnavailable,
+			"gutendex"},
+		{"Deadline", &url.Error{Op: "Get", URL: "http://gutendex/", Err: context.DeadlineExceeded},
+			http.StatusBadGateway, UpstreamTimeout, "gutendex"},
+		// The breaker error is wrapped by http.Client, and names the upstream itself
+		{"Breaker open", &url.Error{Op: "Get", URL: "http://languages/no", Err: &upstream.BreakerOpenError{
+			Upstream: "languages", RetryIn: 2500 * time.Millisecond,
+		}}, http.StatusBadGateway, UpstreamUnavailable, "languages"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			UpstreamError(rr, httptest.NewRequest(http.MethodGet, "/", nil), tt.err, "gutendex", "Failed", tt.status)
+
+			if rr.Code != tt.wantProblem.Status {
+				t.Errorf("Expected status %v, got: %v", tt.wantProblem.Status, rr.Code)
+			}
+			problem := decodeProblem(t, rr)
+			if problem.Type != ProblemTypeURI(tt.wantProblem) || problem.Upstream != tt.wantUpstream {
+				t.Errorf("Unexpected problem: %+v", problem)
+			}
+		})
+	}
+}
+
+func TestUpstreamErrorBreakerRetryAfter(t *testing.T) {
+	rr := httptest.NewRecorder()
+	err := &upstream.BreakerOpenError{Upstream: "languages", RetryIn: 2500 * time.Millisecond}
+	UpstreamError(rr, httptest.NewRequest(http.MethodGet, "/", nil), err, "languages", "Failed",
+		http.StatusBadGateway)
+
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "3" {
+		t.Errorf("Expected Retry-After 3, got: %v", retryAfter)
+	}
+}
+
+func TestUpstreamErrorCancelled(t *testing.T) {
+	rr := httptest.NewRecorder()
+	UpstreamError(rr, httptest.NewRequest(http.MethodGet, "/", nil), context.Canceled, "gutendex", "Failed",
+		http.StatusBadGateway)
+
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected nothing written for a client that went away, got: %q", rr.Body.String())
+	}
+}
+
+func TestGuard(t *testing.T) {
+	// A second problem, and output after a problem, are dropped
+	handler := Guard(func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, r, InvalidParameter, "first", Parameter("language"))
+		WriteProblem(w, r, UpstreamFailure, "second")
+		_, _ = w.Write([]byte("[]"))
+	})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if problem := decodeProblem(t, rr); problem.Detail != "first" || rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected only the first problem, got: %v %+v", rr.Code, problem)
+	}
+}
+
+func TestGuardStarted(t *testing.T) {
+	// A problem after the response has started is dropped
+	handler := Guard(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("[]"))
+		WriteProblem(w, r, InternalError, "too late")
+	})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "[]" {
+		t.Errorf("Expected only the original response, got: %v %q", rr.Code, rr.Body.String())
+	}
+}